@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"time"
+	_ "time/tzdata" // time zones of restart windows, the container image has no zoneinfo
 
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -15,38 +21,276 @@ import (
 )
 
 var options struct {
-	RestartCheckPeriod int      `short:"c" long:"restart-check-period" env:"RESTART_CHECK_PERIOD" description:"Time interval to check for pending restarts in milliseconds" default:"500"`
-	RestartGracePeriod int      `short:"r" long:"restart-grace-period" env:"RESTART_GRACE_PERIOD" description:"Time interval to compact restarts in seconds" default:"5"`
-	IgnoredErrors      []string `long:"ignored-errors" env:"IGNORED_ERRORS" env-delim:";" description:"List of error patterns to just warn of, instead of exiting the controller. Useful if previously legal objects are not valid anymore but have not yet been updated, e.g. on admission control changes. ENV var splits on ; (semicolon)."`
-	Verbose            int      `short:"v" long:"verbose" env:"VERBOSE" description:"Be verbose"`
-	Version            bool     `long:"version" description:"Print version information and exit"`
+	RestartCheckPeriod                int               `short:"c" long:"restart-check-period" env:"RESTART_CHECK_PERIOD" description:"Time interval to check for pending restarts in milliseconds" default:"500"`
+	RestartGracePeriod                int               `short:"r" long:"restart-grace-period" env:"RESTART_GRACE_PERIOD" description:"Time interval to compact restarts in seconds" default:"5"`
+	RestartMaxGracePeriod             int               `long:"restart-max-grace-period" env:"RESTART_MAX_GRACE_PERIOD" description:"Enables debouncing: every new observation of a change restarts the grace period, but a change is never delayed longer than this number of seconds. 0 disables debouncing" default:"0"`
+	ConfigTombstonePeriod             int               `long:"config-tombstone-period" env:"CONFIG_TOMBSTONE_PERIOD" description:"Time interval in seconds to remember checksums of deleted configs, so that recreating a config with different data restarts its deployments. 0 disables it" default:"600"`
+	MaxConcurrentRestarts             int               `long:"max-concurrent-restarts" env:"MAX_CONCURRENT_RESTARTS" description:"Maximum number of restarts in progress. Further restarts are queued. 0 means no limit" default:"0"`
+	MaxConcurrentRestartsPerNamespace int               `long:"max-concurrent-restarts-per-namespace" env:"MAX_CONCURRENT_RESTARTS_PER_NAMESPACE" description:"Maximum number of restarts in progress in a namespace. Further restarts are queued. 0 means no limit" default:"0"`
+	MaxRestartsPerMinute              int               `long:"max-restarts-per-minute" env:"MAX_RESTARTS_PER_MINUTE" description:"Maximum number of restarts triggered within a minute. Further restarts are queued. 0 means no limit" default:"0"`
+	MaxRestartsPerMinutePerNamespace  int               `long:"max-restarts-per-minute-per-namespace" env:"MAX_RESTARTS_PER_MINUTE_PER_NAMESPACE" description:"Maximum number of restarts triggered within a minute in a namespace. Further restarts are queued. 0 means no limit" default:"0"`
+	RestartWaves                      []int             `long:"restart-waves" env:"RESTART_WAVES" env-delim:"," description:"Cumulative percentages of deployments restarted by the waves following the canary wave, when a config change restarts many deployments. Every wave waits for the rollouts of the previous one to complete. Can be given multiple times. ENV var splits on , (comma)."`
+	RestartWavesMinDeployments        int               `long:"restart-waves-min-deployments" env:"RESTART_WAVES_MIN_DEPLOYMENTS" description:"Minimum number of deployments restarted by a config change for the restarts to happen in waves" default:"10"`
+	CircuitBreakerThreshold           int               `long:"circuit-breaker-threshold" env:"CIRCUIT_BREAKER_THRESHOLD" description:"Number of deployments failing to roll out after restarts due to a config change that stops further restarts due to the change. 0 disables it" default:"0"`
+	NamespaceRestartWindows           map[string]string `long:"namespace-restart-window" env:"NAMESPACE_RESTART_WINDOWS" env-delim:";" description:"Schedule of times deployments in a namespace may be restarted at, in the form namespace:schedule. A schedule consists of cron expressions separated by |, optionally prefixed with CRON_TZ=<location>. Can be given multiple times. ENV var splits on ; (semicolon)."`
+	RestartFreeze                     string            `long:"restart-freeze" env:"RESTART_FREEZE" description:"Schedule of times no deployments are restarted at, in the same format as restart windows"`
+	ApprovalTimeout                   int               `long:"approval-timeout" env:"APPROVAL_TIMEOUT" description:"Time interval in seconds after which restarts waiting for approval are approved automatically. 0 means never" default:"0"`
+	ControlConfigMap                  string            `long:"control-configmap" env:"CONTROL_CONFIGMAP" description:"ConfigMap in the form namespace/name to pause updates of deployments with, see README"`
+	MetricsWorkloadLabels             bool              `long:"metrics-workload-labels" env:"METRICS_WORKLOAD_LABELS" description:"Add the name of the restarted deployment to the config_restarts_total metric. Creates one series per config and deployment"`
+	LivenessTimeout                   int               `long:"liveness-timeout" env:"LIVENESS_TIMEOUT" description:"Time interval in seconds after which an inactive update loop fails the liveness probe. 0 only checks the loop is running" default:"60"`
+	MetricsAddress                    string            `long:"metrics-address" env:"METRICS_ADDRESS" description:"Address to serve metrics at" default:"0.0.0.0:10254"`
+	ProbeAddress                      string            `long:"probe-address" env:"PROBE_ADDRESS" description:"Address to serve the /healthz and /readyz probes at" default:"0.0.0.0:10254"`
+	DebugEndpoints                    bool              `long:"debug-endpoints" env:"DEBUG_ENDPOINTS" description:"Serve the /debug endpoints exposing the state of the controller, see README"`
+	DebugAddress                      string            `long:"debug-address" env:"DEBUG_ADDRESS" description:"Address to serve the /debug endpoints at" default:"127.0.0.1:10255"`
+	RolloutTimeout                    int               `long:"rollout-timeout" env:"ROLLOUT_TIMEOUT" description:"Time interval in seconds after which a rollout triggered by a restart is no longer considered in progress" default:"600"`
+	IgnoredErrors                     []string          `long:"ignored-errors" env:"IGNORED_ERRORS" env-delim:";" description:"List of error patterns to just warn of, instead of exiting the controller. Useful if previously legal objects are not valid anymore but have not yet been updated, e.g. on admission control changes. ENV var splits on ; (semicolon)."`
+	Namespaces                        []string          `long:"namespace" env:"NAMESPACES" env-delim:"," description:"Namespace of deployments to update. Can be given multiple times. All namespaces if not given. ENV var splits on , (comma)."`
+	Selector                          string            `long:"selector" env:"SELECTOR" description:"Label selector of deployments to update, e.g. team=web,tier!=cache"`
+	ControllerClass                   string            `long:"controller-class" env:"CONTROLLER_CLASS" description:"Class of deployments to update, given by the class annotation. Deployments without class annotation if not given"`
+	AnnotationPrefix                  string            `long:"annotation-prefix" env:"ANNOTATION_PREFIX" description:"Prefix of the annotations read and written" default:"com.xing.deployment-restart"`
+	LegacyAnnotationPrefix            string            `long:"legacy-annotation-prefix" env:"LEGACY_ANNOTATION_PREFIX" description:"Prefix of annotations read when missing with the annotation prefix, to migrate deployments from another prefix"`
+	ReloaderAnnotations               bool              `long:"reloader-annotations" env:"RELOADER_ANNOTATIONS" description:"Also restart deployments annotated for Stakater Reloader, see README"`
+	ConfigFile                        string            `long:"config-file" env:"CONFIG_FILE" description:"YAML file overriding these options, reloaded when it changes, see README"`
+	ExportGraph                       string            `long:"export-graph" choice:"dot" choice:"json" description:"Print the dependency graph of configs and deployments in the cluster in the given format and exit"`
+	GraphConfig                       string            `long:"graph-config" description:"Restrict the exported graph to the deployments referencing the config, given as configmap/namespace/name or secret/namespace/name"`
+	GraphWorkload                     string            `long:"graph-workload" description:"Restrict the exported graph to the configs referenced by the deployment, given as deployment/namespace/name or statefulset/namespace/name"`
+	Render                            string            `long:"render" description:"Stamp the checksums of the configs in the manifests of the file or directory, or - for stdin, onto the deployments referencing them, print the manifests and exit"`
+	RenderNamespace                   string            `long:"render-namespace" description:"Namespace of rendered resources without one" default:"default"`
+	Verbose                           int               `short:"v" long:"verbose" env:"VERBOSE" description:"Be verbose"`
+	Version                           bool              `long:"version" description:"Print version information and exit"`
 }
 
 // VERSION represents the current version of the release.
 const VERSION = "v1.3.0"
 
+// settingsFileCheckPeriod is the interval to check the settings file for changes. Files
+// mounted from a ConfigMap are updated by the kubelet within about a minute
+const settingsFileCheckPeriod = 10 * time.Second
+
 func main() {
-	util.ParseArgs(&options)
+	// The plan subcommand shares the options of the controller
+	command := util.ParseCommandArgs(&options, util.Command{
+		Name:             "plan",
+		ShortDescription: "Report the updates of deployments and exit",
+		LongDescription:  "List the cluster once and report which deployments the controller would patch or restart. Exits with 2 if any deployment would be updated or references missing configs",
+	})
 
 	if options.Version {
 		printVersion()
 		return
 	}
 
-	http.Handle("/metrics", promhttp.Handler())
-	addr := fmt.Sprintf("0.0.0.0:10254")
-	go func() { glog.Fatal(http.ListenAndServe(addr, nil)) }()
+	namespaceRestartWindows := make(map[string]*util.Schedule)
+	for namespace, spec := range options.NamespaceRestartWindows {
+		schedule, err := util.ParseSchedule(spec)
+		if err != nil {
+			util.ErrorPrintHelpAndExit(&options, err.Error())
+		}
+		namespaceRestartWindows[namespace] = schedule
+	}
+
+	var restartFreeze *util.Schedule
+	if options.RestartFreeze != "" {
+		schedule, err := util.ParseSchedule(options.RestartFreeze)
+		if err != nil {
+			util.ErrorPrintHelpAndExit(&options, err.Error())
+		}
+		restartFreeze = schedule
+	}
+
+	settings := controller.Settings{
+		RestartCheckPeriod:                time.Duration(options.RestartCheckPeriod) * time.Millisecond,
+		RestartGracePeriod:                time.Duration(options.RestartGracePeriod) * time.Second,
+		RestartMaxGracePeriod:             time.Duration(options.RestartMaxGracePeriod) * time.Second,
+		ConfigTombstonePeriod:             time.Duration(options.ConfigTombstonePeriod) * time.Second,
+		MaxConcurrentRestarts:             options.MaxConcurrentRestarts,
+		MaxConcurrentRestartsPerNamespace: options.MaxConcurrentRestartsPerNamespace,
+		MaxRestartsPerMinute:              options.MaxRestartsPerMinute,
+		MaxRestartsPerMinutePerNamespace:  options.MaxRestartsPerMinutePerNamespace,
+		RestartWaves:                      options.RestartWaves,
+		RestartWavesMinDeployments:        options.RestartWavesMinDeployments,
+		CircuitBreakerThreshold:           options.CircuitBreakerThreshold,
+		NamespaceRestartWindows:           namespaceRestartWindows,
+		RestartFreeze:                     restartFreeze,
+		ApprovalTimeout:                   time.Duration(options.ApprovalTimeout) * time.Second,
+		ControlConfigMap:                  options.ControlConfigMap,
+		MetricsWorkloadLabels:             options.MetricsWorkloadLabels,
+		LivenessTimeout:                   time.Duration(options.LivenessTimeout) * time.Second,
+		RolloutTimeout:                    time.Duration(options.RolloutTimeout) * time.Second,
+		IgnoredErrors:                     options.IgnoredErrors,
+		Namespaces:                        options.Namespaces,
+		ControllerClass:                   options.ControllerClass,
+	}
+
+	selector, err := controller.ParseSelector(options.Selector)
+	if err != nil {
+		util.ErrorPrintHelpAndExit(&options, err.Error())
+	}
+	settings.Selector = selector
+
+	annotations, err := controller.NewAnnotations(options.AnnotationPrefix, options.LegacyAnnotationPrefix)
+	if err != nil {
+		util.ErrorPrintHelpAndExit(&options, err.Error())
+	}
+	settings.Annotations = annotations.WithReloader(options.ReloaderAnnotations)
+
+	var settingsFile *controller.SettingsFile
+	if options.ConfigFile != "" {
+		settingsFile = controller.NewSettingsFile(options.ConfigFile, settings)
+		settings, _, err = settingsFile.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load settings: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if options.Render != "" {
+		render(options.Render, options.RenderNamespace, settings.Annotations)
+		return
+	}
+
+	if command == "plan" {
+		printPlan(settings)
+		return
+	}
+
+	if options.ExportGraph != "" {
+		exportGraph(settings)
+		return
+	}
 
-	controller := controller.NewDeploymentConfigController(time.Duration(options.RestartCheckPeriod)*time.Millisecond, time.Duration(options.RestartGracePeriod)*time.Second, options.IgnoredErrors)
+	controller := controller.NewDeploymentConfigController(settings)
 	util.InstallSignalHandler(controller.Stop)
 
-	err := controller.Run()
+	// The settings file is watched until the process exits
+	if settingsFile != nil {
+		go settingsFile.Watch(settingsFileCheckPeriod, controller.UpdateSettings, nil)
+	}
+
+	endpoints := []endpoint{
+		{options.MetricsAddress, "/metrics", promhttp.Handler()},
+		{options.ProbeAddress, "/healthz", probeHandler(controller.Healthy)},
+		{options.ProbeAddress, "/readyz", probeHandler(controller.Ready)},
+	}
+	// The debug endpoints expose the names of all tracked resources without authentication
+	if options.DebugEndpoints {
+		endpoints = append(endpoints,
+			endpoint{options.DebugAddress, "/debug/catalog", http.HandlerFunc(controller.ServeCatalog)},
+			endpoint{options.DebugAddress, "/debug/graph", http.HandlerFunc(controller.ServeGraph)},
+		)
+	}
+	serveHTTP(endpoints)
+
+	err = controller.Run()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Controller terminated: %s", err)
 		os.Exit(1)
 	}
 }
 
+// exportGraph prints the dependency graph of the configs and deployments in the cluster
+func exportGraph(settings controller.Settings) {
+	graph, err := controller.LoadGraph(util.Clientset(), settings, controller.GraphFilter{
+		Config:   options.GraphConfig,
+		Workload: options.GraphWorkload,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load the dependency graph: %s\n", err)
+		os.Exit(1)
+	}
+
+	if options.ExportGraph == "dot" {
+		fmt.Print(graph.DOT())
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(graph)
+}
+
+// printPlan prints the updates the controller would make to the deployments in the cluster.
+// Exits with 2 if any deployment would be updated or references missing configs
+func printPlan(settings controller.Settings) {
+	plan, err := controller.LoadPlan(util.Clientset(), settings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to plan updates: %s\n", err)
+		os.Exit(1)
+	}
+
+	plan.Print(os.Stdout)
+	if plan.Drift() {
+		os.Exit(2)
+	}
+}
+
+// render prints the manifests of the file or directory with config checksums applied.
+// Manifests are read from stdin if the path is -
+func render(path, namespace string, annotations controller.Annotations) {
+	var inputs []io.Reader
+	if path == "-" {
+		inputs = append(inputs, os.Stdin)
+	} else {
+		err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			switch filepath.Ext(file) {
+			case ".yaml", ".yml", ".json":
+				content, err := os.ReadFile(file)
+				if err != nil {
+					return err
+				}
+				inputs = append(inputs, bytes.NewReader(content))
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read manifests: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := controller.Render(inputs, os.Stdout, namespace, annotations); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render manifests: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+type endpoint struct {
+	address string
+	path    string
+	handler http.Handler
+}
+
+// serveHTTP serves the endpoints, sharing a server per address
+func serveHTTP(endpoints []endpoint) {
+	muxes := make(map[string]*http.ServeMux)
+	for _, e := range endpoints {
+		mux, ok := muxes[e.address]
+		if !ok {
+			mux = http.NewServeMux()
+			muxes[e.address] = mux
+		}
+		mux.Handle(e.path, e.handler)
+	}
+
+	for address, mux := range muxes {
+		go func(address string, mux *http.ServeMux) { glog.Fatal(http.ListenAndServe(address, mux)) }(address, mux)
+	}
+}
+
+// probeHandler responds with 200 if the check passes, and with 503 and the error otherwise
+func probeHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
 func printVersion() {
 	fmt.Printf("kubernetes-deployment-restart-controller %s %s/%s %s\n", VERSION, runtime.GOOS, runtime.GOARCH, runtime.Version())
 }
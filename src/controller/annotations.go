@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultAnnotationPrefix is the prefix of the annotations read and written by the controller
+const DefaultAnnotationPrefix = "com.xing.deployment-restart"
+
+// Annotations holds the keys of the annotations read and written by the controller, derived
+// from an annotation prefix. Annotations missing with the prefix are read with the legacy
+// prefix instead, unless it is empty, so that workloads annotated for another prefix keep
+// working while they are migrated. The restart wave key is also read as a label
+type Annotations struct {
+	enabled                  string
+	class                    string
+	configChecksums          string
+	deploymentRestartTrigger string
+	hotReloadVolumes         string
+	extraConfigs             string
+	gracePeriod              string
+	maxGracePeriod           string
+	restartWave              string
+	rolloutStatus            string
+	breakerReset             string
+	renderedChecksum         string
+	restartWindow            string
+	approval                 string
+	approvalTimeout          string
+	restartPending           string
+	restartApproved          string
+	forceRestart             string
+
+	prefix       string
+	legacyPrefix string
+
+	// reloader enables the annotations of Stakater Reloader, see reloader.go
+	reloader bool
+}
+
+// NewAnnotations derives the annotation keys from the prefix. Returns an error if any of the
+// keys with the prefix or the legacy prefix is not a valid annotation key
+func NewAnnotations(prefix, legacyPrefix string) (Annotations, error) {
+	a := Annotations{prefix: prefix}
+	keys := map[*string]string{
+		&a.enabled:                  "",
+		&a.class:                    ".class",
+		&a.configChecksums:          ".applied-config-checksums",
+		&a.deploymentRestartTrigger: ".timestamp",
+		&a.hotReloadVolumes:         ".hot-reload-volumes",
+		&a.extraConfigs:             ".extra-configs",
+		&a.gracePeriod:              ".grace-period",
+		&a.maxGracePeriod:           ".max-grace-period",
+		&a.restartWave:              ".wave",
+		&a.rolloutStatus:            ".rollout-status",
+		&a.breakerReset:             ".reset-breaker",
+		&a.renderedChecksum:         ".rendered-checksum",
+		&a.restartWindow:            ".restart-window",
+		&a.approval:                 ".approval",
+		&a.approvalTimeout:          ".approval-timeout",
+		&a.restartPending:           ".restart-pending",
+		&a.restartApproved:          ".restart-approved",
+		&a.forceRestart:             ".force-restart",
+	}
+
+	for _, p := range []string{prefix, legacyPrefix} {
+		if p == "" {
+			continue
+		}
+		for _, suffix := range keys {
+			if errs := validation.IsQualifiedName(p + suffix); len(errs) > 0 {
+				return Annotations{}, fmt.Errorf("invalid annotation prefix %s: %s", p, strings.Join(errs, ", "))
+			}
+		}
+	}
+
+	for key, suffix := range keys {
+		*key = prefix + suffix
+	}
+	if legacyPrefix != prefix {
+		a.legacyPrefix = legacyPrefix
+	}
+
+	return a, nil
+}
+
+// DefaultAnnotations returns the annotation keys with the default prefix and without a
+// legacy prefix
+func DefaultAnnotations() Annotations {
+	a, _ := NewAnnotations(DefaultAnnotationPrefix, "") // the default prefix is valid
+	return a
+}
+
+// WithReloader returns a copy of the annotations with the annotations of Stakater Reloader
+// enabled or disabled
+func (a Annotations) WithReloader(enabled bool) Annotations {
+	a.reloader = enabled
+	return a
+}
+
+// Reloader returns true if the annotations of Stakater Reloader are understood
+func (a Annotations) Reloader() bool { return a.reloader }
+
+// Prefix returns the prefix of the annotation keys
+func (a Annotations) Prefix() string { return a.prefix }
+
+// LegacyPrefix returns the prefix of the annotation keys read as a fallback, if any
+func (a Annotations) LegacyPrefix() string { return a.legacyPrefix }
+
+// value returns the value of an annotation or label, falling back to the key with the
+// legacy prefix
+func (a Annotations) value(values map[string]string, key string) (string, bool) {
+	if value, ok := values[key]; ok {
+		return value, true
+	}
+
+	if legacyKey := a.legacy(key); legacyKey != "" {
+		value, ok := values[legacyKey]
+		return value, ok
+	}
+
+	return "", false
+}
+
+// legacy returns the key of an annotation with the legacy prefix, or an empty string if
+// there is no legacy prefix
+func (a Annotations) legacy(key string) string {
+	if a.legacyPrefix == "" {
+		return ""
+	}
+	return a.legacyPrefix + strings.TrimPrefix(key, a.prefix)
+}
+
+// withLegacyRemoved adds the removal of the legacy keys of annotations to the annotations
+// of a merge patch
+func (a Annotations) withLegacyRemoved(annotations map[string]interface{}, keys ...string) map[string]interface{} {
+	for _, key := range keys {
+		if legacyKey := a.legacy(key); legacyKey != "" {
+			annotations[legacyKey] = nil // null removes the annotation
+		}
+	}
+	return annotations
+}
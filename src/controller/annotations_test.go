@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/test"
+)
+
+func TestNewAnnotationsDerivesAllKeysFromThePrefix(t *testing.T) {
+	annotations, err := NewAnnotations("platform.example.com/restart", "")
+
+	equals(t, err, nil)
+	equals(t, annotations.Prefix(), "platform.example.com/restart")
+	equals(t, annotations.enabled, "platform.example.com/restart")
+	equals(t, annotations.class, "platform.example.com/restart.class")
+	equals(t, annotations.configChecksums, "platform.example.com/restart.applied-config-checksums")
+	equals(t, annotations.forceRestart, "platform.example.com/restart.force-restart")
+	equals(t, DefaultAnnotations().enabled, DefaultAnnotationPrefix)
+}
+
+func TestNewAnnotationsRejectsInvalidPrefixes(t *testing.T) {
+	for _, prefixes := range [][2]string{
+		{"in valid", ""},
+		{"example.com/a/b", ""},
+		{"restart", "com.xing/"},
+	} {
+		_, err := NewAnnotations(prefixes[0], prefixes[1])
+		equals(t, err != nil, true, prefixes)
+	}
+}
+
+func TestMetaDeploymentReadsLegacyAnnotationsMissingWithThePrefix(t *testing.T) {
+	annotations, _ := NewAnnotations("platform.example.com/restart", DefaultAnnotationPrefix)
+
+	md := MetaDeploymentFromDeployment(newDeploymentFromYAML(`
+---
+metadata:
+  annotations:
+    com.xing.deployment-restart: enabled
+    com.xing.deployment-restart.class: web
+    com.xing.deployment-restart.applied-config-checksums: '{"configmap/test/legacy":"abc"}'
+    com.xing.deployment-restart.wave: legacy
+    platform.example.com/restart.wave: canary
+`), annotations)
+
+	equals(t, md.NeedsRestartOnConfigChange(), true)
+	equals(t, md.ControllerClass(), "web")
+	equals(t, md.AppliedChecksums(), map[string]string{"configmap/test/legacy": "abc"})
+	equals(t, md.RestartWave(), "canary")
+}
+
+func TestMetaDeploymentIgnoresLegacyAnnotationsWithoutLegacyPrefix(t *testing.T) {
+	annotations, _ := NewAnnotations("platform.example.com/restart", "")
+
+	md := MetaDeploymentFromDeployment(newDeploymentFromYAML(`
+---
+metadata:
+  annotations:
+    com.xing.deployment-restart: enabled
+`), annotations)
+
+	equals(t, md.NeedsRestartOnConfigChange(), false)
+}
+
+func TestMetaDeploymentUpdateConfigChecksumsRemovesLegacyChecksums(t *testing.T) {
+	annotations, _ := NewAnnotations("platform.example.com/restart", DefaultAnnotationPrefix)
+	c := test.NewDummyK8sClient()
+	md := MetaDeploymentFromDeployment(newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+`), annotations)
+
+	err := md.UpdateConfigChecksums(c, map[string]string{"config-one": "checksum-one"}, false)
+
+	equals(t, err, nil)
+	equals(t, c.Patches[0].Data, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				"platform.example.com/restart.applied-config-checksums": "{\"config-one\":\"checksum-one\"}",
+				"com.xing.deployment-restart.applied-config-checksums":  nil,
+			},
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// loadCatalog lists the configs and deployments of the cluster once and tracks them in a
+// config agent that is not started. Configs are tracked first, so that deployments are
+// linked to their current checksums
+func loadCatalog(k8sClient kubernetes.Interface, settings Settings) (*RealConfigAgent, error) {
+	agent := NewConfigAgent(k8sClient, settings).(*RealConfigAgent)
+	ctx := context.Background()
+	options := metav1.ListOptions{}
+
+	configMaps, err := k8sClient.CoreV1().ConfigMaps("").List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	for i := range configMaps.Items {
+		agent.trackConfig(MetaConfigFromConfigMap(&configMaps.Items[i], settings.Annotations))
+	}
+
+	secrets, err := k8sClient.CoreV1().Secrets("").List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	for i := range secrets.Items {
+		agent.trackConfig(MetaConfigFromSecret(&secrets.Items[i], settings.Annotations))
+	}
+
+	deployments, err := k8sClient.AppsV1().Deployments("").List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		agent.trackDeployment(MetaDeploymentFromDeployment(&deployments.Items[i], settings.Annotations))
+	}
+
+	statefulSets, err := k8sClient.AppsV1().StatefulSets("").List(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	for i := range statefulSets.Items {
+		agent.trackDeployment(MetaDeploymentFromStatefulSet(&statefulSets.Items[i], settings.Annotations))
+	}
+
+	return agent, nil
+}
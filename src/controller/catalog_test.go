@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadGraphListsTheClusterOnce(t *testing.T) {
+	deployment := newDeploymentFromYAML(`
+---
+metadata:
+  name: app
+  namespace: test
+  annotations:
+    com.xing.deployment-restart: enabled
+spec:
+  template:
+    spec:
+      containers:
+      - envFrom:
+        - configMapRef:
+            name: settings
+        - secretRef:
+            name: missing
+`)
+	ignored := newDeploymentFromYAML(`
+---
+metadata:
+  name: other
+  namespace: test
+`)
+	k8sClient := fake.NewSimpleClientset(newConfigMap("test", "settings", "1", nil), deployment, ignored)
+
+	graph, err := LoadGraph(k8sClient, Settings{Annotations: DefaultAnnotations()}, GraphFilter{})
+
+	equals(t, err, nil)
+	equals(t, graph.Nodes, []GraphNode{
+		{ID: "configmap/test/settings", Kind: "configmap"},
+		{ID: "deployment/test/app", Kind: "deployment"},
+		{ID: "secret/test/missing", Kind: "secret", Pending: true},
+	})
+	equals(t, len(graph.Edges), 2)
+}
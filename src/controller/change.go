@@ -1,24 +1,96 @@
 package controller
 
 import (
+	"sort"
 	"time"
 )
 
-// Change stores a timestamp when the change was observed and the number of observations
+// Change stores the name of the changed resource, timestamps when the change was first and
+// last observed and the number of observations
 type Change struct {
+	Resource     string
 	createdAt    time.Time
+	observedAt   time.Time
 	Observations int
+
+	// Restart is set when the update of the changed deployment is held back and the
+	// deployment is still owed a restart
+	Restart bool
+	// HoldReason tells why the update of the changed deployment is held back
+	HoldReason string
 }
 
-// NewChange returns a new change instance
-func NewChange() *Change {
+// NewChange returns a new change instance of the given resource
+func NewChange(resource string) *Change {
+	now := time.Now()
 	return &Change{
-		createdAt:    time.Now(),
+		Resource:     resource,
+		createdAt:    now,
+		observedAt:   now,
 		Observations: 1,
 	}
 }
 
+// Observe registers another observation of the change
+func (c *Change) Observe() {
+	c.Observations++
+	c.observedAt = time.Now()
+}
+
+// Hold marks the change as held back for the given reason with a restart owed. Returns
+// true if the change was not held back for the same reason before
+func (c *Change) Hold(reason string) bool {
+	c.Restart = true
+	return c.Postpone(reason)
+}
+
+// Postpone marks the change as held back for the given reason without a restart owed.
+// Returns true if the change was not held back for the same reason before
+func (c *Change) Postpone(reason string) bool {
+	if c.HoldReason == reason {
+		return false
+	}
+	c.HoldReason = reason
+	return true
+}
+
 // Age returns the duration since when the change was instantiated
 func (c *Change) Age() time.Duration {
 	return time.Now().Sub(c.createdAt)
 }
+
+// Idle returns the duration since when the change was last observed
+func (c *Change) Idle() time.Duration {
+	return time.Now().Sub(c.observedAt)
+}
+
+// ObservedAfter returns true if the change was last observed after the other change was
+// first observed
+func (c *Change) ObservedAfter(other *Change) bool {
+	return c.observedAt.After(other.createdAt)
+}
+
+// ObservedAfterTime returns true if the change was last observed after the given time
+func (c *Change) ObservedAfterTime(t time.Time) bool {
+	return c.observedAt.After(t)
+}
+
+// Ready returns true if the change has waited long enough to be processed. A positive
+// maxGracePeriod makes every observation restart the grace period, until the change
+// waits for maxGracePeriod in total
+func (c *Change) Ready(gracePeriod, maxGracePeriod time.Duration) bool {
+	if maxGracePeriod > 0 {
+		return c.Idle() >= gracePeriod || c.Age() >= maxGracePeriod
+	}
+	return c.Age() >= gracePeriod
+}
+
+// sortChanges orders changes by the time of their first observation
+func sortChanges(changes []*Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].createdAt.Equal(changes[j].createdAt) {
+			return changes[i].Resource < changes[j].Resource
+		}
+		return changes[i].createdAt.Before(changes[j].createdAt)
+	})
+}
@@ -6,15 +6,96 @@ import (
 )
 
 func TestNewChangeReturnsAChangeWithOneObservationAndPositiveAge(t *testing.T) {
-	c := NewChange()
+	c := NewChange("test")
 
 	equals(t, c.Observations, 1)
 	equals(t, c.Age() > time.Duration(0), true)
 }
 
 func TestChangeAgeIncreasesOverTime(t *testing.T) {
-	c := NewChange()
+	c := NewChange("test")
 	age := c.Age()
 	time.Sleep(10 * time.Millisecond)
 	equals(t, c.Age() > age, true)
 }
+
+func TestChangeObserveIncrementsObservationsAndResetsIdleTime(t *testing.T) {
+	c := NewChange("test")
+	time.Sleep(10 * time.Millisecond)
+	idle := c.Idle()
+	c.Observe()
+
+	equals(t, c.Observations, 2)
+	equals(t, c.Idle() < idle, true)
+	equals(t, c.Age() >= idle, true)
+}
+
+func TestChangeReadyWaitsForGracePeriodSinceCreation(t *testing.T) {
+	c := NewChange("test")
+	equals(t, c.Ready(10*time.Millisecond, 0), false)
+
+	time.Sleep(10 * time.Millisecond)
+	c.Observe()
+	equals(t, c.Ready(10*time.Millisecond, 0), true)
+}
+
+func TestChangeReadyWithMaxGracePeriodWaitsForGracePeriodSinceLastObservation(t *testing.T) {
+	c := NewChange("test")
+	time.Sleep(10 * time.Millisecond)
+	c.Observe()
+	equals(t, c.Ready(10*time.Millisecond, time.Second), false)
+
+	time.Sleep(10 * time.Millisecond)
+	equals(t, c.Ready(10*time.Millisecond, time.Second), true)
+}
+
+func TestChangeReadyWithMaxGracePeriodDoesNotWaitLongerThanMaxGracePeriod(t *testing.T) {
+	c := NewChange("test")
+	time.Sleep(10 * time.Millisecond)
+	c.Observe()
+
+	equals(t, c.Ready(time.Second, 10*time.Millisecond), true)
+}
+
+func TestChangeObservedAfterComparesLastObservationWithFirstObservationOfOtherChange(t *testing.T) {
+	first := NewChange("first")
+	time.Sleep(time.Millisecond)
+	second := NewChange("second")
+
+	equals(t, first.ObservedAfter(second), false)
+	equals(t, second.ObservedAfter(first), true)
+
+	time.Sleep(time.Millisecond)
+	first.Observe()
+	equals(t, first.ObservedAfter(second), true)
+}
+
+func TestSortChangesOrdersChangesByFirstObservation(t *testing.T) {
+	first := NewChange("first")
+	time.Sleep(time.Millisecond)
+	second := NewChange("second")
+	first.Observe()
+
+	changes := []*Change{second, first}
+	sortChanges(changes)
+
+	equals(t, changes, []*Change{first, second})
+}
+
+func TestChangeHoldMarksChangeAsOwingARestart(t *testing.T) {
+	c := NewChange("test")
+
+	equals(t, c.Hold("throttled"), true)
+	equals(t, c.Hold("throttled"), false)
+	equals(t, c.Restart, true)
+	equals(t, c.HoldReason, "throttled")
+}
+
+func TestChangePostponeDoesNotMarkChangeAsOwingARestart(t *testing.T) {
+	c := NewChange("test")
+
+	equals(t, c.Postpone("paused"), true)
+	equals(t, c.Postpone("paused"), false)
+	equals(t, c.Restart, false)
+	equals(t, c.HoldReason, "paused")
+}
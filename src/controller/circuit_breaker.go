@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"sort"
+)
+
+// CircuitBreaker counts failed rollouts of deployments restarted due to a config checksum.
+// Once open, it stops further restarts due to the same checksum
+type CircuitBreaker struct {
+	Config   string
+	Checksum string
+	failures map[string]struct{}
+	open     bool
+}
+
+// NewCircuitBreaker returns a closed circuit breaker for the given config checksum
+func NewCircuitBreaker(config, checksum string) *CircuitBreaker {
+	return &CircuitBreaker{
+		Config:   config,
+		Checksum: checksum,
+		failures: make(map[string]struct{}),
+	}
+}
+
+// RecordFailure records a failed rollout of the deployment and opens the breaker when the
+// number of failed deployments reaches the threshold. Returns true if the breaker opened
+func (b *CircuitBreaker) RecordFailure(deploymentName string, threshold int) bool {
+	b.failures[deploymentName] = struct{}{}
+	if b.open || len(b.failures) < threshold {
+		return false
+	}
+
+	b.open = true
+	return true
+}
+
+// Open returns true if restarts due to the checksum are stopped
+func (b *CircuitBreaker) Open() bool {
+	return b.open
+}
+
+// Failures returns the sorted names of deployments whose rollouts failed
+func (b *CircuitBreaker) Failures() []string {
+	names := make([]string, 0, len(b.failures))
+	for name := range b.failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"testing"
+)
+
+func TestCircuitBreakerOpensWhenFailuresReachThreshold(t *testing.T) {
+	b := NewCircuitBreaker("configmap/test/config", "checksum")
+
+	equals(t, b.RecordFailure("deployment/test/b", 2), false)
+	equals(t, b.RecordFailure("deployment/test/b", 2), false) // the same deployment counts once
+	equals(t, b.Open(), false)
+
+	equals(t, b.RecordFailure("deployment/test/a", 2), true)
+	equals(t, b.Open(), true)
+	equals(t, b.Failures(), []string{"deployment/test/a", "deployment/test/b"})
+
+	equals(t, b.RecordFailure("deployment/test/c", 2), false) // already open
+}
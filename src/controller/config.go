@@ -8,6 +8,12 @@ import (
 type Config struct {
 	checksum    string
 	Deployments map[string]*Deployment
+
+	forceRestartTrigger string
+	acknowledgedTrigger string
+	// forcedConsumers are the deployments not yet restarted as requested by the
+	// acknowledged trigger
+	forcedConsumers map[string]struct{}
 }
 
 // NewPendingConfig returns a pending config with empty deployments map
@@ -19,10 +25,12 @@ func NewPendingConfig() *Config {
 
 // NewConfig returns a Config with an initialized checksum and empty deployments map
 func NewConfig(meta interfaces.MetaConfig) *Config {
-	return &Config{
+	config := &Config{
 		checksum:    meta.Checksum(),
 		Deployments: make(map[string]*Deployment),
 	}
+	config.observeForceRestartTrigger(meta)
+	return config
 }
 
 // Checksum returns the checksum or an empty string if the checksum is not set
@@ -36,11 +44,53 @@ func (c *Config) Pending() bool {
 }
 
 // UpdateFromMeta copies the checksum from a given MetaConfig. Returns true if the new
-// checksum if different from the old one
+// checksum if different from the old one, or if a restart of all consumers was requested
 func (c *Config) UpdateFromMeta(meta interfaces.MetaConfig) bool {
 	oldChecksum := c.checksum
 	c.checksum = meta.Checksum()
-	return c.checksum != oldChecksum
+	triggered := c.observeForceRestartTrigger(meta)
+	return c.checksum != oldChecksum || triggered
+}
+
+// ForcedRestart returns true if a restart of all consumers was requested by the force
+// restart annotation and has not been acknowledged yet
+func (c *Config) ForcedRestart() bool {
+	return c.forceRestartTrigger != ""
+}
+
+// AcknowledgeForcedRestart marks the requested restart as handed over to the given
+// consumers, see ForcedRestartDone. Returns the value of the annotation that requested it
+func (c *Config) AcknowledgeForcedRestart(deploymentNames []string) string {
+	trigger := c.forceRestartTrigger
+	c.acknowledgedTrigger = trigger
+	c.forceRestartTrigger = ""
+
+	c.forcedConsumers = make(map[string]struct{}, len(deploymentNames))
+	for _, name := range deploymentNames {
+		c.forcedConsumers[name] = struct{}{}
+	}
+	return trigger
+}
+
+// ForcedRestartDone marks the requested restart of a consumer as done. Returns true if it
+// was the last consumer not yet restarted
+func (c *Config) ForcedRestartDone(deploymentName string) bool {
+	if _, ok := c.forcedConsumers[deploymentName]; !ok {
+		return false
+	}
+
+	delete(c.forcedConsumers, deploymentName)
+	return len(c.forcedConsumers) == 0
+}
+
+func (c *Config) observeForceRestartTrigger(meta interfaces.MetaConfig) bool {
+	trigger := meta.ForceRestartTrigger()
+	if trigger == "" || trigger == c.acknowledgedTrigger || trigger == c.forceRestartTrigger {
+		return false
+	}
+
+	c.forceRestartTrigger = trigger
+	return true
 }
 
 // Unused returns true if the config is not used by any deployment and does not have
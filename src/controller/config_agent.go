@@ -1,24 +1,41 @@
 package controller
 
 import (
+	"fmt"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
 	"github.com/xing/kubernetes-deployment-restart-controller/src/lib"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	holdReasonThrottled = "throttled"
+	holdReasonWave      = "wave"
+	holdReasonBreaker   = "breaker"
+	holdReasonDeferred  = "deferred"
+	holdReasonApproval  = "approval"
+	holdReasonPaused    = "paused"
+	holdReasonResume    = "resume"
+	holdReasonWindow    = "invalid-window"
+
+	triggerConfig     = "config"
+	triggerDeployment = "deployment"
+	triggerForced     = "forced"
+)
+
 // RealConfigAgent implements interfaces.ConfigAgent
 type RealConfigAgent struct {
 	updateResourceCh chan interfaces.MetaResource
 	deleteResourceCh chan interfaces.MetaResource
 
-	restartCheckPeriod time.Duration
-	restartGracePeriod time.Duration
-
-	ignoredErrors []string
+	settings Settings
 
 	configs     map[string]*Config
 	deployments map[string]*Deployment
@@ -26,24 +43,33 @@ type RealConfigAgent struct {
 	versions map[string]string
 	changes  map[string]*Change
 
+	limiter   *RestartLimiter
+	wavePlans map[string]*WavePlan
+	breakers  map[string]*CircuitBreaker
+	control   ControlState
+
 	k8sClient        interfaces.K8sClient
 	processChangesCh chan struct{}
+	snapshotCh       chan snapshotRequest
+	settingsCh       chan Settings
+	ticker           *time.Ticker
 	stopCh           chan struct{}
 	stoppedCh        chan struct{}
 
 	stopWithErrorCh chan struct{}
+
+	// lastActivity is the time in unix nanoseconds the update loop last processed changes,
+	// read by health checks from other goroutines
+	lastActivity atomic.Int64
 }
 
 // NewConfigAgent creates a new real instance of interfaces.ConfigAgent
-func NewConfigAgent(k8sClient kubernetes.Interface, restartCheckPeriod, restartGracePeriod time.Duration, ignoredErrors []string) interfaces.ConfigAgent {
+func NewConfigAgent(k8sClient kubernetes.Interface, settings Settings) interfaces.ConfigAgent {
 	return &RealConfigAgent{
 		updateResourceCh: make(chan interfaces.MetaResource),
 		deleteResourceCh: make(chan interfaces.MetaResource),
 
-		restartCheckPeriod: restartCheckPeriod,
-		restartGracePeriod: restartGracePeriod,
-
-		ignoredErrors: ignoredErrors,
+		settings: settings,
 
 		configs:     make(map[string]*Config),
 		deployments: make(map[string]*Deployment),
@@ -51,13 +77,28 @@ func NewConfigAgent(k8sClient kubernetes.Interface, restartCheckPeriod, restartG
 		versions: make(map[string]string),
 		changes:  make(map[string]*Change),
 
+		limiter:   NewRestartLimiter(),
+		wavePlans: make(map[string]*WavePlan),
+		breakers:  make(map[string]*CircuitBreaker),
+
 		k8sClient:        lib.NewK8sClient(k8sClient),
 		processChangesCh: make(chan struct{}),
+		snapshotCh:       make(chan snapshotRequest),
+		settingsCh:       make(chan Settings),
 		stopCh:           make(chan struct{}),
 		stoppedCh:        make(chan struct{}),
 	}
 }
 
+// LastActivity returns the time the update loop last processed changes, the zero time if
+// the agent has not been started
+func (c *RealConfigAgent) LastActivity() time.Time {
+	if nanos := c.lastActivity.Load(); nanos > 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
 // ResourceUpdated tracks k8s resource updates and additions
 func (c *RealConfigAgent) ResourceUpdated(res interfaces.MetaResource) {
 	c.updateResourceCh <- res
@@ -71,15 +112,22 @@ func (c *RealConfigAgent) ResourceDeleted(res interfaces.MetaResource) {
 // Start the agent as a goroutine
 func (c *RealConfigAgent) Start(stopWithErrorCh chan struct{}) {
 	c.stopWithErrorCh = stopWithErrorCh
+	c.lastActivity.Store(time.Now().UnixNano())
+	c.ticker = time.NewTicker(c.settings.RestartCheckPeriod)
 	go c.updateLoop()
 	go func() {
-		ticker := time.NewTicker(c.restartCheckPeriod)
-		for range ticker.C {
+		for range c.ticker.C {
 			c.processChangesCh <- struct{}{}
 		}
 	}()
 }
 
+// UpdateSettings replaces the settings of a running agent. They take effect with the next
+// change processed
+func (c *RealConfigAgent) UpdateSettings(settings Settings) {
+	c.settingsCh <- settings
+}
+
 // Stop the agent gracefully
 func (c *RealConfigAgent) Stop() {
 	c.stopCh <- struct{}{}
@@ -88,21 +136,23 @@ func (c *RealConfigAgent) Stop() {
 }
 
 func (c *RealConfigAgent) updateLoop() {
-	gracefulChange := func(change *Change) bool {
-		return change.Age() >= c.restartGracePeriod
+	gracefulChange := func(change *Change, deployment *Deployment) bool {
+		return change.Ready(c.gracePeriods(deployment))
 	}
 
-	memoryStateSensitiveChange := func(change *Change) bool {
-		// Multiple observations of a config change can cause a restart to be missed if
-		// the change is discarded. We should process them before terminating the agent.
-		// See updateDeployment method for more details.
-		return change.Observations > 1
-
-		// TODO: there's another possibility: a new deployment is added that references an
-		// existing config. The config then is updated within the grace period of the
-		// deployment change, and before the deployment change gets processed controller
-		// gets terminated. Would require the name of the affected resource to be stored
-		// to check for this situation.
+	memoryStateSensitiveChange := func(change *Change, deployment *Deployment) bool {
+		// Multiple observations of a config change, as well as a config change observed
+		// after a pending change of a deployment referencing the config, can cause a
+		// restart to be missed if the change is discarded. We should process them before
+		// terminating the agent. See updateDeployment method for more details.
+		if change.Observations > 1 {
+			return true
+		}
+		if deployment == nil || change.Resource == deployment.meta.FullName() {
+			return false
+		}
+		deploymentChange, ok := c.changes[deployment.meta.FullName()]
+		return ok && change.ObservedAfter(deploymentChange)
 	}
 
 	for {
@@ -131,8 +181,18 @@ func (c *RealConfigAgent) updateLoop() {
 			c.updateResourceGaugeMetrics()
 
 		case <-c.processChangesCh:
+			c.trackRollouts()
+			c.pruneCircuitBreakers()
+			c.advanceWavePlans()
 			c.processChanges(gracefulChange)
-			ChangesWaitingTotal.WithLabelValues().Set(float64(len(c.changes)))
+			c.updateChangeGaugeMetrics()
+			c.lastActivity.Store(time.Now().UnixNano())
+
+		case request := <-c.snapshotCh:
+			request.replyCh <- c.snapshot(request.filter)
+
+		case settings := <-c.settingsCh:
+			c.applySettings(settings)
 
 		case <-c.stopCh:
 			c.processChanges(memoryStateSensitiveChange)
@@ -143,6 +203,46 @@ func (c *RealConfigAgent) updateLoop() {
 	}
 }
 
+// applySettings replaces the settings. Deployments no longer watched are cleaned up, and the
+// versions of other deployments are forgotten, so that deployments watched now are tracked
+// when the informers deliver them again. All versions are forgotten when the annotations
+// change, so that every resource is read again with the new annotations
+func (c *RealConfigAgent) applySettings(settings Settings) {
+	previous := c.settings
+	c.settings = settings
+
+	if settings.Annotations != previous.Annotations {
+		c.versions = make(map[string]string)
+	}
+
+	if c.ticker != nil && settings.RestartCheckPeriod != previous.RestartCheckPeriod {
+		c.ticker.Reset(settings.RestartCheckPeriod)
+	}
+
+	if settings.ControlConfigMap != previous.ControlConfigMap {
+		c.updateControlState(ControlState{})
+		delete(c.versions, c.controlConfigName())
+	}
+
+	for name, deployment := range c.deployments {
+		if !settings.Watches(deployment.meta) {
+			c.cleanupDeployment(deployment.meta)
+			delete(c.versions, name)
+		}
+	}
+	for name := range c.versions {
+		switch resourceType(name) {
+		case deploymentTypeDeployment, deploymentTypeStatefulSet:
+			if _, ok := c.deployments[name]; !ok {
+				delete(c.versions, name)
+			}
+		}
+	}
+
+	c.updateResourceGaugeMetrics()
+	glog.Info("Settings updated")
+}
+
 func (c *RealConfigAgent) knownVersion(res interfaces.MetaResource) bool {
 	name := res.FullName()
 	version := res.Version()
@@ -160,6 +260,15 @@ func (c *RealConfigAgent) knownVersion(res interfaces.MetaResource) bool {
 func (c *RealConfigAgent) trackConfig(meta interfaces.MetaConfig) {
 	name := meta.FullName()
 
+	if name == c.controlConfigName() {
+		c.updateControlState(ControlStateFromData(meta.Data()))
+	}
+
+	if breaker, ok := c.breakers[name]; ok && breaker.Open() && meta.BreakerReset() == breaker.Checksum {
+		glog.Infof("Circuit breaker of config %s reset, restarts due to checksum %s resume", name, breaker.Checksum)
+		delete(c.breakers, name)
+	}
+
 	config, ok := c.configs[name]
 	if ok {
 		if !config.UpdateFromMeta(meta) {
@@ -168,18 +277,48 @@ func (c *RealConfigAgent) trackConfig(meta interfaces.MetaConfig) {
 
 		glog.V(1).Infof("Config %s updated. New checksum: %s", name, config.Checksum())
 	} else {
-		c.configs[name] = NewConfig(meta)
+		config = NewConfig(meta)
+		c.configs[name] = config
 
 		glog.V(3).Infof("Config %s added", name)
+
+		c.relinkRecreatedConfig(name)
 	}
 
 	c.trackResourceChange(name)
+
+	// Deployments with a shorter grace period are updated before the change completes,
+	// the plan has to be in place by then
+	c.planRestartWaves(name, config.Deployments)
+}
+
+// relinkRecreatedConfig links a recreated config to the deployments that still reference
+// it and hold its tombstone
+func (c *RealConfigAgent) relinkRecreatedConfig(configName string) {
+	for deploymentName, deployment := range c.deployments {
+		tombstone, ok := deployment.Tombstones[configName]
+		if !ok {
+			continue
+		}
+
+		if tombstone.Age() >= c.settings.ConfigTombstonePeriod || !deployment.References(configName) {
+			delete(deployment.Tombstones, configName)
+			continue
+		}
+
+		glog.V(2).Infof("Config %s was recreated, relinking it to %s", configName, deploymentName)
+		c.linkConfigToDeployment(configName, deploymentName)
+
+		if deployment.AppliedChecksums[configName] == c.configs[configName].Checksum() {
+			delete(deployment.Tombstones, configName) // nothing to apply
+		}
+	}
 }
 
 func (c *RealConfigAgent) trackDeployment(meta interfaces.MetaDeployment) {
 	name := meta.FullName()
 
-	if !meta.NeedsRestartOnConfigChange() {
+	if !meta.NeedsRestartOnConfigChange() || !c.settings.Watches(meta) {
 		glog.V(3).Infof("Deployment %s does not participate in dynamic config", name)
 		c.cleanupDeployment(meta)
 		return
@@ -210,10 +349,17 @@ func (c *RealConfigAgent) trackDeployment(meta interfaces.MetaDeployment) {
 		delete(orphanedConfigs, configName) // a config is not orphaned if referenced
 	}
 
+	for configName := range deployment.Tombstones {
+		if !deployment.References(configName) {
+			delete(deployment.Tombstones, configName)
+		}
+	}
+
 	for configName := range orphanedConfigs {
 		config := c.configs[configName]
 		delete(config.Deployments, name)
 		delete(deployment.Configs, configName)
+		c.forcedRestartDone(configName, name)
 
 		glog.V(3).Infof("Config %s is no longer referenced by deployment %s", configName, name)
 
@@ -249,10 +395,10 @@ func (c *RealConfigAgent) linkConfigToDeployment(configName, deploymentName stri
 func (c *RealConfigAgent) trackResourceChange(name string) {
 	change, ok := c.changes[name]
 	if ok {
-		change.Observations++
+		change.Observe()
 		glog.V(3).Infof("Resource %s changed %d times", name, change.Observations)
 	} else {
-		c.changes[name] = NewChange()
+		c.changes[name] = NewChange(name)
 		glog.V(3).Infof("Resource %s changed", name)
 	}
 }
@@ -274,6 +420,7 @@ func (c *RealConfigAgent) cleanupDeployment(metaDeployment interfaces.MetaDeploy
 
 	for configName, config := range deployment.Configs {
 		delete(config.Deployments, deploymentName)
+		c.forcedRestartDone(configName, deploymentName)
 
 		if config.Unused() {
 			c.cleanupConfigByName(configName)
@@ -282,71 +429,178 @@ func (c *RealConfigAgent) cleanupDeployment(metaDeployment interfaces.MetaDeploy
 
 	delete(c.deployments, deploymentName)
 	delete(c.changes, deploymentName)
+	c.limiter.Forget(deploymentName)
+	if c.settings.MetricsWorkloadLabels {
+		ConfigRestartsTotal.DeletePartialMatch(prometheus.Labels{"workload": deploymentName})
+	}
 
 	glog.V(3).Infof("Cleaned up deployment %s", deploymentName)
 }
 
 func (c *RealConfigAgent) cleanupConfig(meta interfaces.MetaConfig) {
+	if meta.FullName() == c.controlConfigName() {
+		c.updateControlState(ControlState{})
+	}
+
 	c.cleanupConfigByName(meta.FullName())
 }
 
+// controlConfigName returns the full name of the control ConfigMap, if any
+func (c *RealConfigAgent) controlConfigName() string {
+	parts := strings.SplitN(c.settings.ControlConfigMap, "/", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return FullName(configTypeConfigMap, parts[0], parts[1])
+}
+
+func (c *RealConfigAgent) updateControlState(state ControlState) {
+	switch {
+	case state.Paused && !c.control.Paused:
+		glog.Warning("Updates of all deployments are paused")
+	case !state.Paused && c.control.Paused:
+		glog.Info("Updates of deployments are resumed")
+	}
+	if len(state.PausedNamespaces) > 0 {
+		glog.V(1).Infof("Updates of deployments are paused in %d namespaces", len(state.PausedNamespaces))
+	}
+
+	c.control = state
+
+	paused := 0.0
+	if state.Paused {
+		paused = 1
+	}
+	Paused.WithLabelValues().Set(paused)
+	PausedNamespacesTotal.WithLabelValues().Set(float64(len(state.PausedNamespaces)))
+}
+
 func (c *RealConfigAgent) cleanupConfigByName(name string) {
 	if config, ok := c.configs[name]; ok {
-		for _, deployment := range config.Deployments {
+		for deploymentName, deployment := range config.Deployments {
 			delete(deployment.Configs, name)
+
+			if checksum, ok := deployment.AppliedChecksums[name]; ok && c.settings.ConfigTombstonePeriod > 0 {
+				deployment.Tombstones[name] = NewTombstone(checksum)
+				glog.V(3).Infof("Remembering checksum %s of config %s applied to %s", checksum, name, deploymentName)
+			}
 		}
 	}
 
 	delete(c.configs, name)
 	delete(c.changes, name)
+	ConfigRestartsTotal.DeletePartialMatch(prometheus.Labels{"config": name})
 
 	glog.V(3).Infof("Cleaned up config %s", name)
 }
 
-func (c *RealConfigAgent) processChanges(applicable func(*Change) bool) {
-	if len(c.changes) == 0 {
+// processChanges updates deployments affected by applicable changes. Changes are processed
+// in the order of their observation. A change of a config can be applicable to some of the
+// deployments referencing it but not yet to the others, in which case it stays in the
+// queue until it is applicable to all of them.
+func (c *RealConfigAgent) processChanges(applicable func(*Change, *Deployment) bool) {
+	if len(c.changes) == 0 || c.control.Paused {
 		return
 	}
 
 	var processedChanges []string
-	deploymentsToBeUpdated := make(map[string]struct{})
+	var deploymentsToBeUpdated []string
+	deploymentsSeen := make(map[string]struct{})
 
 	glog.V(3).Infof("Changes in the queue: %d", len(c.changes))
 
-	for resourceName, change := range c.changes {
-		if !applicable(change) {
-			continue
-		}
-
-		processedChanges = append(processedChanges, resourceName)
+	changes := make([]*Change, 0, len(c.changes))
+	for _, change := range c.changes {
+		changes = append(changes, change)
+	}
+	sortChanges(changes)
 
+	for _, change := range changes {
+		resourceName := change.Resource
 		deployments := c.affectedDeployments(resourceName)
 		if deployments == nil {
-			glog.Warningf("Orphaned resource change ignored: %s", resourceName)
+			if applicable(change, nil) {
+				processedChanges = append(processedChanges, resourceName)
+				glog.Warningf("Orphaned resource change ignored: %s", resourceName)
+			}
 			continue
 		}
 
-		glog.V(2).Infof("Processing resource change: %s", resourceName)
+		// Deployments might have been linked to the config since the change was observed
+		c.planRestartWaves(resourceName, deployments)
 
+		// A change without affected deployments follows the default timing
+		complete := len(deployments) > 0 || applicable(change, nil)
 		for deploymentName, deployment := range deployments {
-			if deployment.NeedsUpdate() {
-				deploymentsToBeUpdated[deploymentName] = struct{}{}
-				glog.V(2).Infof("Deployment %s needs an update", deploymentName)
+			if !applicable(change, deployment) {
+				complete = false
+				continue
+			}
+
+			if _, ok := deploymentsSeen[deploymentName]; ok {
+				continue
+			}
+
+			if deployment.NeedsUpdate() || deployment.ForcedRestart {
+				deployment.ObserveChange(change.createdAt)
+				deploymentsSeen[deploymentName] = struct{}{}
+				deploymentsToBeUpdated = append(deploymentsToBeUpdated, deploymentName)
+				glog.V(2).Infof("Deployment %s needs an update due to %s", deploymentName, resourceName)
 			}
 		}
-	}
 
-	for deploymentName := range deploymentsToBeUpdated {
-		c.updateDeployment(c.deployments[deploymentName])
-		delete(c.changes, deploymentName) // Any potential deployment change has been applied
-		DeploymentAnnotationUpdatesTotal.WithLabelValues().Inc()
+		if complete {
+			processedChanges = append(processedChanges, resourceName)
+			glog.V(2).Infof("Processing resource change: %s", resourceName)
+
+			if config, ok := c.configs[resourceName]; ok && config.ForcedRestart() {
+				for deploymentName, deployment := range deployments {
+					deployment.ForceRestart(resourceName)
+					deployment.ObserveChange(change.createdAt)
+					if _, ok := deploymentsSeen[deploymentName]; !ok {
+						deploymentsSeen[deploymentName] = struct{}{}
+						deploymentsToBeUpdated = append(deploymentsToBeUpdated, deploymentName)
+					}
+				}
+				c.acknowledgeForcedRestart(resourceName, config, deployments)
+			}
+		}
 	}
 
-	ChangesProcessedTotal.WithLabelValues().Add(float64(len(processedChanges)))
+	heldDeployments := make(map[string]struct{})
+	for _, deploymentName := range deploymentsToBeUpdated {
+		if !c.updateDeployment(c.deployments[deploymentName]) {
+			heldDeployments[deploymentName] = struct{}{}
+			continue
+		}
+		c.completeChange(deploymentName) // Any potential deployment change has been applied
+	}
 
 	for _, v := range processedChanges {
-		delete(c.changes, v)
+		if _, ok := heldDeployments[v]; ok {
+			continue
+		}
+		c.completeChange(v)
+		ChangesProcessedTotal.WithLabelValues().Inc()
+	}
+}
+
+// gracePeriods returns the grace period and the maximum grace period of changes affecting
+// the deployment. Deployment annotations take precedence over the agent settings
+func (c *RealConfigAgent) gracePeriods(deployment *Deployment) (time.Duration, time.Duration) {
+	gracePeriod := c.settings.RestartGracePeriod
+	maxGracePeriod := c.settings.RestartMaxGracePeriod
+
+	if deployment != nil {
+		if value, ok := deployment.meta.GracePeriod(); ok {
+			gracePeriod = value
+		}
+		if value, ok := deployment.meta.MaxGracePeriod(); ok {
+			maxGracePeriod = value
+		}
 	}
+
+	return gracePeriod, maxGracePeriod
 }
 
 func (c *RealConfigAgent) affectedDeployments(resourceName string) map[string]*Deployment {
@@ -361,62 +615,582 @@ func (c *RealConfigAgent) affectedDeployments(resourceName string) map[string]*D
 	return nil
 }
 
-func (c *RealConfigAgent) updateDeployment(deployment *Deployment) {
-	restart := false
+// updateDeployment saves current config checksums on the deployment and restarts it if
+// necessary. Returns false if the update is held back and has to be retried later
+func (c *RealConfigAgent) updateDeployment(deployment *Deployment) bool {
+	name := deployment.meta.FullName()
 
-	for name, config := range deployment.Configs {
-		if config.Pending() || config.Checksum() == deployment.AppliedChecksums[name] {
-			continue
+	if namespace := deployment.meta.Namespace(); c.control.PausesNamespace(namespace) {
+		if c.deploymentChange(deployment).Postpone(holdReasonPaused) {
+			glog.V(1).Infof("Update of deployment %s is held back: namespace %s is paused", name, namespace)
 		}
+		return false
+	}
+	checksums, restartConfigs := c.plannedUpdate(deployment)
+	restart := len(restartConfigs) > 0 || deployment.ForcedRestart
 
-		// TODO: consider this situation: deployment gets created, it references an
-		// existing config. Shortly after that the config is modified. Deployment should
-		// be restarted, but if the config change gets processed first, it will not be.
-		// This needs to be fixed. Could be enough to order the changes by timestamp.
+	if change, ok := c.changes[name]; ok && change.Restart {
+		restart = true // a held back restart is still owed
+	}
 
-		if _, ok := deployment.AppliedChecksums[name]; ok {
-			restart = true
-		} else {
-			change, ok := c.changes[name]
-			if ok && change.Observations > 1 {
-				// Normally, having no config checksum in deployment annotation would mean
-				// the config was recently added to the deployment and is in fact already
-				// applied (restart was triggered by spec change). However, multiple
-				// observations mean the config was added to the deployment and then
-				// updated, before the controller managed to react to the addition. In
-				// that case deployment must be restarted to apply the change.
-				restart = true
-			}
+	// A restart of a deployment without pods is pointless, the configs are picked up once
+	// it is scaled up
+	scaledToZero := restart && deployment.meta.ScaledToZero()
+	if scaledToZero {
+		glog.V(1).Infof("Deployment %s is scaled to zero, saving checksums without restart", name)
+		restart = false
+	}
+
+	if restart {
+		if deployment.meta.RolloutPaused() {
+			c.holdDeployment(deployment, holdReasonResume, "rollout is paused")
+			return false
+		}
+
+		if breaker := c.openCircuitBreaker(restartConfigs); breaker != nil {
+			c.holdDeployment(deployment, holdReasonBreaker, fmt.Sprintf("circuit breaker of %s is open", breaker.Config))
+			return false
+		}
+
+		if _, err := deployment.meta.RestartWindow(); err != nil {
+			c.holdDeployment(deployment, holdReasonWindow, err.Error())
+			return false
+		}
+
+		if reason := c.deferredRestart(deployment, time.Now()); reason != "" {
+			c.holdDeployment(deployment, holdReasonDeferred, reason)
+			return false
+		}
+
+		if id, pending := c.pendingApproval(deployment, restartConfigs, checksums); pending {
+			c.holdDeployment(deployment, holdReasonApproval, "waiting for approval of restart "+id)
+			return false
+		}
+
+		if plan := c.holdingWavePlan(deployment); plan != nil {
+			c.holdDeployment(deployment, holdReasonWave, fmt.Sprintf("waiting for wave %d/%d of %s", plan.Wave(), plan.Waves(), plan.Config))
+			return false
 		}
 
-		deployment.AppliedChecksums[name] = config.Checksum()
+		if ok, limit := c.limiter.Allow(deployment, c.settings); !ok {
+			c.holdDeployment(deployment, holdReasonThrottled, "exceeds "+limit)
+			return false
+		}
 	}
 
-	// Purge checksums that reference unknown configs
-	for name := range deployment.AppliedChecksums {
-		if _, ok := deployment.Configs[name]; !ok {
-			delete(deployment.AppliedChecksums, name)
+	metricLabels := []string{deployment.meta.Namespace(), resourceType(name), updateTrigger(deployment, checksums, restartConfigs)}
+
+	deployment.AppliedChecksums = checksums
+	for configName, config := range deployment.Configs {
+		if !config.Pending() {
+			delete(deployment.Tombstones, configName)
 		}
 	}
 
+	patchStart := time.Now()
 	err := deployment.SaveChecksums(c.k8sClient, restart)
+	PatchDurationSeconds.WithLabelValues().Observe(time.Since(patchStart).Seconds())
 	if err != nil {
 		if reason, ignored := c.isIgnoredError(err); ignored {
-			glog.Warningf("Deployment %s failed to update, but error was configured as non-critical: %s", deployment.meta.FullName(), reason)
+			glog.Warningf("Deployment %s failed to update, but error was configured as non-critical: %s", name, reason)
 		} else {
 			c.stopWithError(err)
 		}
-		return
+		return true
+	}
+	DeploymentAnnotationUpdatesTotal.WithLabelValues(metricLabels...).Inc()
+
+	if latency, ok := deployment.ChangesApplied(); ok {
+		ChangeLatencySeconds.WithLabelValues().Observe(latency.Seconds())
 	}
 
 	if restart {
-		DeploymentRestartsTotal.WithLabelValues().Inc()
+		c.limiter.Record(deployment)
+		DeploymentRestartsTotal.WithLabelValues(metricLabels...).Inc()
+		c.countConfigRestarts(name, restartConfigs)
+
+		deployment.RestartedConfigs = restartConfigs
+		c.saveRolloutStatus(deployment, RolloutProgressing)
+	} else if scaledToZero {
+		RestartsSkippedTotal.WithLabelValues().Inc()
 	}
+
+	if restart || scaledToZero {
+		if err := deployment.ClearPendingRestart(c.k8sClient); err != nil {
+			glog.Warningf("Failed to clear pending restart of deployment %s: %s", name, err)
+		}
+
+		if deployment.ForcedRestart {
+			forcedConfigs := deployment.ForcedConfigs()
+			ForcedRestartsTotal.WithLabelValues().Inc()
+			if err := deployment.AcknowledgeForcedRestart(c.k8sClient); err != nil {
+				glog.Warningf("Failed to acknowledge forced restart of deployment %s: %s", name, err)
+			}
+			for _, configName := range forcedConfigs {
+				c.forcedRestartDone(configName, name)
+			}
+		}
+	}
+
+	return true
+}
+
+// updateTrigger tells what caused the update of the deployment, for metrics. It has to be
+// called before the planned checksums are applied
+func updateTrigger(deployment *Deployment, checksums map[string]string, restartConfigs []string) string {
+	if deployment.ForcedRestart {
+		return triggerForced
+	}
+
+	if len(restartConfigs) > 0 {
+		return triggerConfig
+	}
+
+	for name, checksum := range checksums {
+		if applied, ok := deployment.AppliedChecksums[name]; ok && applied != checksum {
+			return triggerConfig
+		}
+	}
+
+	return triggerDeployment
+}
+
+// countConfigRestarts counts the restart of the deployment for every config that caused it
+func (c *RealConfigAgent) countConfigRestarts(deploymentName string, restartConfigs []string) {
+	workload := ""
+	if c.settings.MetricsWorkloadLabels {
+		workload = deploymentName
+	}
+
+	for _, configName := range restartConfigs {
+		ConfigRestartsTotal.WithLabelValues(configName, workload).Inc()
+	}
+}
+
+// plannedUpdate returns config checksums to be saved on the deployment according to the
+// current state of the catalog, and the sorted names of configs the deployment needs to be
+// restarted for
+func (c *RealConfigAgent) plannedUpdate(deployment *Deployment) (map[string]string, []string) {
+	checksums := make(map[string]string)
+	var restartConfigs []string
+
+	// Checksums of unknown configs are purged
+	for name, config := range deployment.Configs {
+		applied, ok := deployment.AppliedChecksums[name]
+
+		if config.Pending() {
+			if ok {
+				checksums[name] = applied
+			}
+			continue
+		}
+
+		checksums[name] = config.Checksum()
+		if ok && config.Checksum() == applied {
+			continue
+		}
+
+		configRestart := false
+		if ok {
+			configRestart = true
+		} else {
+			// Normally, having no config checksum in deployment annotation would mean the
+			// config was recently added to the deployment and is in fact already applied
+			// (restart was triggered by spec change).
+			configRestart = c.configChangedAfterDeployment(name, deployment.meta.FullName())
+		}
+
+		// The config was deleted and recreated, e.g. by kubectl replace --force
+		tombstone, recreated := deployment.Tombstones[name]
+		if recreated && tombstone.Age() < c.settings.ConfigTombstonePeriod && tombstone.Checksum != config.Checksum() {
+			glog.V(2).Infof("Config %s was recreated with different data", name)
+			configRestart = true
+		}
+
+		if configRestart {
+			if deployment.HotReloads(name) {
+				glog.V(2).Infof("Config %s is hot reloaded by deployment %s, no restart needed", name, deployment.meta.FullName())
+			} else if c.templateChangedAfterConfig(name, deployment) {
+				glog.V(1).Infof("Deployment %s was rolled out after change of config %s, no restart needed", deployment.meta.FullName(), name)
+			} else {
+				restartConfigs = append(restartConfigs, name)
+			}
+		}
+	}
+
+	for _, name := range deployment.ForcedConfigs() {
+		if !containsString(restartConfigs, name) {
+			restartConfigs = append(restartConfigs, name)
+		}
+	}
+
+	sort.Strings(restartConfigs)
+	return checksums, restartConfigs
+}
+
+// acknowledgeForcedRestart hands the restart requested by the force restart annotation of
+// the config over to its consumers. The annotation is removed once all of them are
+// restarted, see forcedRestartDone
+func (c *RealConfigAgent) acknowledgeForcedRestart(configName string, config *Config, deployments map[string]*Deployment) {
+	deploymentNames := make([]string, 0, len(deployments))
+	for deploymentName := range deployments {
+		deploymentNames = append(deploymentNames, deploymentName)
+	}
+
+	trigger := config.AcknowledgeForcedRestart(deploymentNames)
+	glog.V(1).Infof("Restart of all deployments referencing %s requested: %s", configName, trigger)
+
+	if len(deploymentNames) == 0 {
+		c.clearForcedRestart(configName)
+	}
+}
+
+// forcedRestartDone marks the restart of a deployment requested by the force restart
+// annotation of a config as done, because the deployment was restarted, skipped or no
+// longer references the config. The annotation is removed after the last consumer
+func (c *RealConfigAgent) forcedRestartDone(configName, deploymentName string) {
+	if config, ok := c.configs[configName]; ok && config.ForcedRestartDone(deploymentName) {
+		c.clearForcedRestart(configName)
+	}
+}
+
+func (c *RealConfigAgent) clearForcedRestart(configName string) {
+	glog.V(1).Infof("Restart of all deployments referencing %s done", configName)
+
+	if err := ClearConfigForceRestartTrigger(c.k8sClient, configName, c.settings.Annotations); err != nil {
+		glog.Warningf("Failed to acknowledge forced restart of config %s: %s", configName, err)
+	}
+}
+
+// trackRollouts reports the outcome of rollouts triggered by restarts once they complete,
+// fail or time out
+func (c *RealConfigAgent) trackRollouts() {
+	progressing := 0
+	for _, deployment := range c.deployments {
+		state, ok := deployment.UnreportedRolloutState(c.settings.RolloutTimeout)
+		if !ok {
+			continue
+		}
+
+		if state == RolloutProgressing {
+			progressing++
+			continue
+		}
+
+		c.saveRolloutStatus(deployment, state)
+
+		switch state {
+		case RolloutComplete:
+			RolloutsCompletedTotal.WithLabelValues().Inc()
+			RolloutDurationSeconds.WithLabelValues().Observe(deployment.SinceRestart().Seconds())
+		case RolloutFailed:
+			RolloutsFailedTotal.WithLabelValues().Inc()
+			c.recordRolloutFailure(deployment)
+		case RolloutTimedOut:
+			RolloutsTimedOutTotal.WithLabelValues().Inc()
+			c.recordRolloutFailure(deployment)
+		}
+	}
+
+	RolloutsProgressingTotal.WithLabelValues().Set(float64(progressing))
+}
+
+// saveRolloutStatus records the rollout state on the deployment. Failures are not critical
+// and only logged
+func (c *RealConfigAgent) saveRolloutStatus(deployment *Deployment, state RolloutState) {
+	name := deployment.meta.FullName()
+	if state == RolloutFailed || state == RolloutTimedOut {
+		glog.Warningf("Rollout of deployment %s after restart due to %s %s", name, restartCause(deployment.RestartedConfigs), state)
+	} else {
+		glog.V(2).Infof("Rollout of deployment %s after restart due to %s %s", name, restartCause(deployment.RestartedConfigs), state)
+	}
+
+	if err := deployment.SaveRolloutStatus(c.k8sClient, state); err != nil {
+		glog.Warningf("Failed to save rollout status of deployment %s: %s", name, err)
+	}
+}
+
+// recordRolloutFailure counts a failed rollout towards the circuit breakers of the configs
+// that caused the restart, with the checksums applied by the restart
+func (c *RealConfigAgent) recordRolloutFailure(deployment *Deployment) {
+	if c.settings.CircuitBreakerThreshold == 0 {
+		return
+	}
+
+	name := deployment.meta.FullName()
+	for _, configName := range deployment.RestartedConfigs {
+		checksum := deployment.AppliedChecksums[configName]
+
+		breaker, ok := c.breakers[configName]
+		if !ok || breaker.Checksum != checksum {
+			breaker = NewCircuitBreaker(configName, checksum)
+			c.breakers[configName] = breaker
+		}
+
+		if !breaker.RecordFailure(name, c.settings.CircuitBreakerThreshold) {
+			continue
+		}
+
+		message := fmt.Sprintf("Restarts due to checksum %s are stopped after failed rollouts of %s", checksum, strings.Join(breaker.Failures(), ", "))
+		glog.Warningf("Circuit breaker of config %s opened. %s", configName, message)
+		CircuitBreakersOpenedTotal.WithLabelValues().Inc()
+
+		if event := NewConfigEvent(configName, v1.EventTypeWarning, "ConfigRestartsStopped", message); event != nil {
+			if err := c.k8sClient.CreateEvent(event); err != nil {
+				glog.Warningf("Failed to record event of config %s: %s", configName, err)
+			}
+		}
+	}
+}
+
+// pruneCircuitBreakers closes circuit breakers of configs that changed again or were deleted
+func (c *RealConfigAgent) pruneCircuitBreakers() {
+	open := 0
+	for configName, breaker := range c.breakers {
+		config, ok := c.configs[configName]
+		if !ok || config.Checksum() != breaker.Checksum {
+			if breaker.Open() {
+				glog.Infof("Circuit breaker of config %s closed, the config changed", configName)
+			}
+			delete(c.breakers, configName)
+			continue
+		}
+
+		if breaker.Open() {
+			open++
+		}
+	}
+
+	CircuitBreakersOpenTotal.WithLabelValues().Set(float64(open))
+}
+
+// openCircuitBreaker returns an open circuit breaker of any of the configs matching its
+// current checksum, if any
+func (c *RealConfigAgent) openCircuitBreaker(configNames []string) *CircuitBreaker {
+	for _, configName := range configNames {
+		breaker, ok := c.breakers[configName]
+		if ok && breaker.Open() && breaker.Checksum == c.configs[configName].Checksum() {
+			return breaker
+		}
+	}
+	return nil
+}
+
+// planRestartWaves creates a wave plan for a config change that restarts enough of the
+// deployments referencing the config, unless there is one for the change already
+func (c *RealConfigAgent) planRestartWaves(configName string, deployments map[string]*Deployment) {
+	config, ok := c.configs[configName]
+	if !ok || config.Pending() || len(c.settings.RestartWaves) == 0 {
+		return
+	}
+
+	if plan, ok := c.wavePlans[configName]; ok && plan.Checksum == config.Checksum() {
+		return
+	}
+
+	var restarted []*Deployment
+	for _, deployment := range deployments {
+		applied, ok := deployment.AppliedChecksums[configName]
+		if ok && applied != config.Checksum() && !deployment.HotReloads(configName) {
+			restarted = append(restarted, deployment)
+		}
+	}
+
+	if len(restarted) < c.settings.RestartWavesMinDeployments {
+		return
+	}
+
+	plan := NewWavePlan(configName, config.Checksum(), restarted, c.settings.RestartWaves)
+	c.wavePlans[configName] = plan
+
+	glog.V(1).Infof("Restarting %d deployments referencing %s in %d waves", len(restarted), configName, plan.Waves())
+}
+
+// advanceWavePlans starts the next waves of plans whose current waves rolled out, and drops
+// finished plans as well as plans of configs that changed again or were deleted
+func (c *RealConfigAgent) advanceWavePlans() {
+	for configName, plan := range c.wavePlans {
+		config, ok := c.configs[configName]
+		if !ok || config.Pending() || config.Checksum() != plan.Checksum {
+			glog.V(2).Infof("Dropping restart wave plan of %s", configName)
+			delete(c.wavePlans, configName)
+			continue
+		}
+
+		if plan.Failed() {
+			continue
+		}
+
+		wave := plan.Wave()
+		plan.Advance(c.deployments, c.settings.RolloutTimeout)
+
+		switch {
+		case plan.Failed():
+			glog.Warningf("Wave %d/%d of %s failed or did not complete in time, remaining restarts are stopped", plan.Wave(), plan.Waves(), configName)
+			WavePlansFailedTotal.WithLabelValues().Inc()
+		case plan.Finished():
+			glog.V(1).Infof("All restart waves of %s completed", configName)
+			delete(c.wavePlans, configName)
+		case plan.Wave() != wave:
+			glog.V(1).Infof("Starting restart wave %d/%d of %s", plan.Wave(), plan.Waves(), configName)
+		}
+	}
+}
+
+// holdingWavePlan returns the wave plan holding back the restart of the deployment, if any
+func (c *RealConfigAgent) holdingWavePlan(deployment *Deployment) *WavePlan {
+	name := deployment.meta.FullName()
+	for configName := range deployment.Configs {
+		plan, ok := c.wavePlans[configName]
+		if ok && deployment.AppliedChecksums[configName] != plan.Checksum && plan.Holds(name) {
+			return plan
+		}
+	}
+	return nil
+}
+
+// deferredRestart returns why a restart of the deployment is not allowed at the given time,
+// or an empty string if it is. The freeze schedule applies to all deployments. The restart
+// window of a deployment takes precedence over the one of its namespace
+func (c *RealConfigAgent) deferredRestart(deployment *Deployment, now time.Time) string {
+	if freeze := c.settings.RestartFreeze; freeze != nil && freeze.Matches(now) {
+		return fmt.Sprintf("restart freeze %q", freeze)
+	}
+
+	window, _ := deployment.meta.RestartWindow() // invalid windows hold restarts beforehand
+	if window == nil {
+		window = c.settings.NamespaceRestartWindows[deployment.meta.Namespace()]
+	}
+	if window != nil && !window.Matches(now) {
+		return fmt.Sprintf("outside of restart window %q", window)
+	}
+
+	return ""
+}
+
+// pendingApproval returns the ID of the restart and true if the deployment requires
+// approval of restarts and the restart has neither been approved nor timed out. The ID
+// identifies the configs and checksums causing the restart
+func (c *RealConfigAgent) pendingApproval(deployment *Deployment, restartConfigs []string, checksums map[string]string) (string, bool) {
+	if !deployment.meta.ApprovalRequired() {
+		return "", false
+	}
+
+	restartChecksums := make(map[string]string, len(restartConfigs))
+	for _, configName := range restartConfigs {
+		restartChecksums[configName] = checksums[configName]
+	}
+	id := getSha(restartChecksums)
+	name := deployment.meta.FullName()
+
+	if deployment.meta.ApprovedRestart() == id {
+		glog.V(1).Infof("Restart %s of deployment %s was approved", id, name)
+		return id, false
+	}
+
+	since, err := deployment.RequestRestartApproval(c.k8sClient, id, restartConfigs)
+	if err != nil {
+		glog.Warningf("Failed to request approval of restart %s of deployment %s: %s", id, name, err)
+	}
+
+	timeout := c.settings.ApprovalTimeout
+	if value, ok := deployment.meta.ApprovalTimeout(); ok {
+		timeout = value
+	}
+	if timeout > 0 && !since.IsZero() && time.Now().Sub(since) >= timeout {
+		glog.V(1).Infof("Restart %s of deployment %s was approved automatically after %s", id, name, timeout)
+		RestartsAutoApprovedTotal.WithLabelValues().Inc()
+		return id, false
+	}
+
+	return id, true
+}
+
+// holdDeployment keeps a change of the deployment in the queue, so that its update and the
+// owed restart are retried later
+func (c *RealConfigAgent) holdDeployment(deployment *Deployment, reason, details string) {
+	name := deployment.meta.FullName()
+
+	if c.deploymentChange(deployment).Hold(reason) {
+		glog.V(1).Infof("Restart of deployment %s is held back: %s", name, details)
+
+		switch reason {
+		case holdReasonThrottled:
+			RestartsThrottledTotal.WithLabelValues().Inc()
+		case holdReasonResume:
+			message := "Restart due to config changes is deferred until the rollout is resumed"
+			if err := deployment.meta.RecordEvent(c.k8sClient, v1.EventTypeNormal, "ConfigRestartDeferred", message); err != nil {
+				glog.Warningf("Failed to record event of deployment %s: %s", name, err)
+			}
+		case holdReasonWindow:
+			glog.Warningf("Restart of deployment %s is held back: %s", name, details)
+			message := fmt.Sprintf("Restart due to config changes is held back until the restart window is fixed: %s", details)
+			if err := deployment.meta.RecordEvent(c.k8sClient, v1.EventTypeWarning, "InvalidRestartWindow", message); err != nil {
+				glog.Warningf("Failed to record event of deployment %s: %s", name, err)
+			}
+		}
+	}
+}
+
+// deploymentChange returns the change of the deployment, creating it if necessary
+func (c *RealConfigAgent) deploymentChange(deployment *Deployment) *Change {
+	name := deployment.meta.FullName()
+
+	change, ok := c.changes[name]
+	if !ok {
+		change = NewChange(name)
+		c.changes[name] = change
+	}
+	return change
+}
+
+// templateChangedAfterConfig returns true if the pod template of the deployment changed
+// after a pending change of the config was observed. The rollout of the template change,
+// e.g. by a deploy pipeline updating both, already picks up the config
+func (c *RealConfigAgent) templateChangedAfterConfig(configName string, deployment *Deployment) bool {
+	configChange, ok := c.changes[configName]
+	return ok && deployment.TemplateChangedAfter(configChange.createdAt)
+}
+
+// configChangedAfterDeployment returns true if a pending change of a config not yet applied
+// to the deployment happened after the deployment has been rolled out with it
+func (c *RealConfigAgent) configChangedAfterDeployment(configName, deploymentName string) bool {
+	configChange, ok := c.changes[configName]
+	if !ok {
+		return false
+	}
+
+	// The deployment was added or changed to reference the config, and the config was
+	// updated afterwards. The pods might still use the previous config version. This holds
+	// regardless of which of the two changes gets processed first, and whether the change
+	// of the deployment has already been processed.
+	if deploymentChange, ok := c.changes[deploymentName]; ok {
+		return configChange.ObservedAfterTime(deploymentChange.observedAt)
+	}
+
+	deployment, ok := c.deployments[deploymentName]
+	if !ok || deployment.specObservedAt.IsZero() {
+		return false
+	}
+	return configChange.ObservedAfterTime(deployment.specObservedAt)
+}
+
+// completeChange removes a processed change from the queue. A deployment remembers when
+// its own change was last observed, see configChangedAfterDeployment
+func (c *RealConfigAgent) completeChange(name string) {
+	change, ok := c.changes[name]
+	if !ok {
+		return
+	}
+	if deployment, ok := c.deployments[name]; ok {
+		deployment.SpecChangeProcessed(change.observedAt)
+	}
+	delete(c.changes, name)
 }
 
 func (c *RealConfigAgent) isIgnoredError(err error) (string, bool) {
 	str := err.Error()
-	for _, reason := range c.ignoredErrors {
+	for _, reason := range c.settings.IgnoredErrors {
 		if strings.Contains(str, reason) {
 			return reason, true
 		}
@@ -434,3 +1208,39 @@ func (c *RealConfigAgent) updateResourceGaugeMetrics() {
 	ConfigsTotal.WithLabelValues().Set(float64(len(c.configs)))
 	DeploymentsTotal.WithLabelValues().Set(float64(len(c.deployments)))
 }
+
+func (c *RealConfigAgent) updateChangeGaugeMetrics() {
+	queued := 0
+	deferred := 0
+	pendingApproval := 0
+	waitingForResume := 0
+	invalidWindow := 0
+	var oldestWaiting time.Duration
+	for _, change := range c.changes {
+		if age := change.Age(); change.HoldReason != holdReasonDeferred && age > oldestWaiting {
+			oldestWaiting = age
+		}
+
+		switch change.HoldReason {
+		case holdReasonThrottled:
+			queued++
+		case holdReasonDeferred:
+			deferred++
+		case holdReasonApproval:
+			pendingApproval++
+		case holdReasonResume:
+			waitingForResume++
+		case holdReasonWindow:
+			invalidWindow++
+		}
+	}
+
+	ChangesWaitingTotal.WithLabelValues().Set(float64(len(c.changes) - deferred))
+	RestartsQueuedTotal.WithLabelValues().Set(float64(queued))
+	RestartsDeferredTotal.WithLabelValues().Set(float64(deferred))
+	RestartsPendingApprovalTotal.WithLabelValues().Set(float64(pendingApproval))
+	RestartsWaitingForResumeTotal.WithLabelValues().Set(float64(waitingForResume))
+	RestartsInvalidWindowTotal.WithLabelValues().Set(float64(invalidWindow))
+	OldestChangeAgeSeconds.WithLabelValues().Set(oldestWaiting.Seconds())
+	WavePlansTotal.WithLabelValues().Set(float64(len(c.wavePlans)))
+}
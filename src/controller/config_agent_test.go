@@ -2,9 +2,12 @@ package controller
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/test"
 	"github.com/xing/kubernetes-deployment-restart-controller/src/util"
 )
@@ -25,6 +28,20 @@ func TestControllerStopChReceivesStopOnError(t *testing.T) {
 	<-controllerStopCh
 }
 
+func TestLastActivityIsUpdatedByTheUpdateLoop(t *testing.T) {
+	a := agent()
+	equals(t, a.LastActivity().IsZero(), true)
+
+	a.Start(nil)
+	started := a.LastActivity()
+	a.processChangesCh <- struct{}{}
+	a.processChangesCh <- struct{}{} // the previous tick has been processed once this one is received
+	a.Stop()
+
+	equals(t, started.IsZero(), false)
+	equals(t, a.LastActivity().After(started), true)
+}
+
 func TestResourceUpdatedTracksNewConfigs(t *testing.T) {
 	a := agent()
 	c := configA()
@@ -267,7 +284,7 @@ func TestConfigChangesGetProcessedInGracePeriod(t *testing.T) {
 func TestConfigChangesOrphanedResourceChangesGetCleanedUp(t *testing.T) {
 	a := agent()
 
-	a.changes["non-existent"] = NewChange()
+	a.changes["non-existent"] = NewChange("non-existent")
 	a.Start(nil)
 	time.Sleep(150 * time.Millisecond)
 	a.Stop()
@@ -275,6 +292,63 @@ func TestConfigChangesOrphanedResourceChangesGetCleanedUp(t *testing.T) {
 	equals(t, len(a.changes), 0)
 }
 
+func TestConfigChangesWaitForDeploymentGracePeriod(t *testing.T) {
+	a := agent()
+	c := configAUpdated()
+	d := deploymentA()
+	d.GracePeriodValue = durationOf(time.Second)
+
+	a.Start(nil)
+	a.ResourceUpdated(c)
+	a.ResourceUpdated(d)
+	time.Sleep(150 * time.Millisecond)
+	a.Stop()
+
+	equals(t, len(a.changes), 2)
+	equals(t, d.UpdatedChecksums, map[string]string(nil))
+}
+
+func TestConfigChangesSkipTheGracePeriodOfDeploymentsWithZeroGracePeriod(t *testing.T) {
+	a := agent()
+	a.settings.RestartGracePeriod = time.Hour
+	d := deploymentA()
+	d.GracePeriodValue = durationOf(0)
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(func(change *Change, deployment *Deployment) bool {
+		return change.Ready(a.gracePeriods(deployment))
+	})
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedRestart, true)
+}
+
+func TestConfigChangesGetDebouncedWithMaxGracePeriod(t *testing.T) {
+	a := agent()
+	a.settings.RestartMaxGracePeriod = time.Second
+	d := deploymentA()
+
+	a.Start(nil)
+	a.ResourceUpdated(configA())
+	a.ResourceUpdated(d)
+	time.Sleep(150 * time.Millisecond)
+	for i, checksum := range []string{"bcd", "cde", "def"} {
+		a.ResourceUpdated(test.NewMetaConfigWithParams(configA().FullName(), fmt.Sprint(i), checksum))
+		time.Sleep(60 * time.Millisecond)
+	}
+	restartedEarly := d.UpdatedRestart
+	time.Sleep(100 * time.Millisecond)
+	a.Stop()
+
+	equals(t, restartedEarly, false)
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums[configA().FullName()], "def")
+	equals(t, d.UpdatedRestart, true)
+}
+
 func TestConfigChangesNewDeploymentsGetChecksumUpdatesWithoutRestarts(t *testing.T) {
 	a := agent()
 	c := configAUpdated()
@@ -318,6 +392,49 @@ func TestConfigChangesConfigChangeGetDeploymentChecksumsUpdatedWithRestart(t *te
 	equals(t, d.UpdatedRestart, true)
 }
 
+func TestConfigChangesHotReloadedConfigChangeGetsDeploymentChecksumsUpdatedWithoutRestart(t *testing.T) {
+	a := agent()
+	c := configAUpdated()
+	d := deploymentA()
+	d.HotReloadedConfigsValue = []string{c.FullName()}
+
+	a.Start(nil)
+	a.ResourceUpdated(c)
+	a.ResourceUpdated(d)
+	time.Sleep(150 * time.Millisecond)
+	a.Stop()
+
+	expectedChecksums := map[string]string{
+		c.FullName():         c.Checksum(),
+		configB().FullName(): configB().Checksum(),
+	}
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums, expectedChecksums)
+	equals(t, d.UpdatedRestart, false)
+}
+
+func TestConfigChangesConfigInAnotherNamespaceGetsDeploymentRestarted(t *testing.T) {
+	a := agent()
+	c1 := test.NewMetaConfigWithParams("secret/kube-system/ca-bundle", "12345", "abc")
+	c2 := test.NewMetaConfigWithParams("secret/kube-system/ca-bundle", "23456", "bcd")
+	d := deploymentA()
+	d.ReferencedConfigsValue = []string{c1.FullName()}
+	d.AppliedChecksumsValue = map[string]string{c1.FullName(): c1.Checksum()}
+
+	a.Start(nil)
+	a.ResourceUpdated(c1)
+	a.ResourceUpdated(d)
+	time.Sleep(150 * time.Millisecond)
+	a.ResourceUpdated(c2)
+	time.Sleep(150 * time.Millisecond)
+	a.Stop()
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums, map[string]string{c2.FullName(): c2.Checksum()})
+	equals(t, d.UpdatedRestart, true)
+}
+
 func TestConfigChangesConfigChangeCleansUpDeploymentChange(t *testing.T) {
 	a := agent()
 	c := configAUpdated()
@@ -390,6 +507,871 @@ func TestConfigChangesUnsavedImportantChangesGetAppliedWhenStopped(t *testing.T)
 	equals(t, d.UpdatedRestart, true)
 }
 
+func TestConfigChangesNewDeploymentIsRestartedWhenConfigChangesAfterIt(t *testing.T) {
+	a, d := agentWithNewDeployment()
+	observe(a, configAUpdated())
+
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, true)
+}
+
+func TestConfigChangesNewDeploymentIsRestartedWhenItsChangeIsProcessedBeforeConfigChange(t *testing.T) {
+	a, d := agentWithNewDeployment()
+	observe(a, configAUpdated())
+
+	a.processChanges(changesOf(d.FullName()))
+
+	equals(t, len(a.changes), 1)
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, true)
+
+	d.UpdatedChecksums = nil
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums, map[string]string(nil))
+}
+
+func TestConfigChangesNewDeploymentIsRestartedWhenConfigChangeIsProcessedBeforeItsChange(t *testing.T) {
+	a, d := agentWithNewDeployment()
+	observe(a, configAUpdated())
+
+	a.processChanges(changesOf(configA().FullName()))
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, true)
+}
+
+func TestConfigChangesNewDeploymentIsRestartedForConfigCreatedAfterItsChangeWasProcessed(t *testing.T) {
+	a := agent()
+	d := deploymentWithoutAppliedChecksums()
+
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configA())
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums[configA().FullName()], configA().Checksum())
+	equals(t, d.UpdatedRestart, true)
+}
+
+func TestConfigChangesNewDeploymentIsNotRestartedWhenConfigChangesBeforeIt(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	delete(d.AppliedChecksumsValue, configA().FullName())
+
+	observe(a, configA())
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	observe(a, d)
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, false)
+}
+
+func TestConfigChangesNewDeploymentIsNotRestartedWhenConfigChangesSeveralTimesBeforeIt(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	delete(d.AppliedChecksumsValue, configA().FullName())
+
+	observe(a, configA())
+	observe(a, configAUpdated())
+	observe(a, d)
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, false)
+}
+
+func TestConfigChangesNewDeploymentIsRestartedWhenStoppedWithinGracePeriodOfConfigChange(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	delete(d.AppliedChecksumsValue, configA().FullName())
+
+	a.Start(nil)
+	a.ResourceUpdated(configA())
+	time.Sleep(150 * time.Millisecond)
+	a.ResourceUpdated(d)
+	a.ResourceUpdated(configAUpdated())
+	a.Stop()
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, true)
+}
+
+func TestConfigChangesKnownDeploymentIsRestartedWhenPendingConfigIsCreatedAndUpdated(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	delete(d.AppliedChecksumsValue, configA().FullName())
+
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configA())
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, true)
+}
+
+func TestConfigChangesRecreatedConfigWithDifferentDataGetsDeploymentRestarted(t *testing.T) {
+	a := agentWithDeletedConfig()
+	d := a.deployments[deploymentA().FullName()].meta.(*test.DummyMetaDeployment)
+
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, true)
+}
+
+func TestConfigChangesRecreatedConfigWithSameDataDoesNotGetDeploymentRestarted(t *testing.T) {
+	a := agentWithDeletedConfig()
+	d := a.deployments[deploymentA().FullName()].meta.(*test.DummyMetaDeployment)
+
+	observe(a, configA())
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, d.UpdatedChecksums, map[string]string(nil))
+	equals(t, len(a.deployments[d.FullName()].Tombstones), 0)
+}
+
+func TestConfigChangesRecreatedConfigDoesNotGetDeploymentRestartedAfterTombstonePeriod(t *testing.T) {
+	a := agentWithDeletedConfig()
+	a.settings.ConfigTombstonePeriod = time.Millisecond
+	d := a.deployments[deploymentA().FullName()].meta.(*test.DummyMetaDeployment)
+
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, len(a.deployments[d.FullName()].Configs), 0)
+	equals(t, d.UpdatedChecksums, map[string]string(nil))
+}
+
+func TestConfigChangesThrottledRestartsAreQueued(t *testing.T) {
+	a := agent()
+	a.settings.MaxRestartsPerMinute = 1
+	d1 := deploymentA()
+	d2 := deploymentB()
+	d2.AppliedChecksumsValue = map[string]string{configA().FullName(): configA().Checksum()}
+
+	observe(a, configA())
+	observe(a, d1)
+	observe(a, d2)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, d1.UpdatedRestart != d2.UpdatedRestart, true)
+	equals(t, len(a.changes), 1)
+
+	queued := d1
+	if d1.UpdatedRestart {
+		queued = d2
+	}
+	change := a.changes[queued.FullName()]
+	equals(t, change.Restart, true)
+	equals(t, change.HoldReason, holdReasonThrottled)
+	equals(t, queued.UpdatedChecksums[configA().FullName()] != configAUpdated().Checksum(), true)
+
+	a.limiter.history = nil
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, queued.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, queued.UpdatedRestart, true)
+}
+
+func TestConfigChangesRestartsHappenInWaves(t *testing.T) {
+	a := agent()
+	a.settings.RestartWaves = []int{100}
+	a.settings.RestartWavesMinDeployments = 2
+	a.settings.RolloutTimeout = time.Minute
+	d1 := deploymentA()
+	d2 := deploymentB()
+	d2.AppliedChecksumsValue = map[string]string{configA().FullName(): configA().Checksum()}
+
+	observe(a, configA())
+	observe(a, d1)
+	observe(a, d2)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.advanceWavePlans()
+	a.processChanges(allChanges)
+
+	equals(t, len(a.wavePlans), 1)
+	equals(t, d1.UpdatedRestart, true)
+	equals(t, d2.UpdatedRestart, false)
+	equals(t, a.changes[d2.FullName()].HoldReason, holdReasonWave)
+
+	a.advanceWavePlans()
+	a.processChanges(allChanges)
+
+	equals(t, d2.UpdatedRestart, false) // canary rollout is in progress
+
+	d1.GenerationValue = 1
+	d1.RolloutCompleteValue = true
+	a.advanceWavePlans()
+	a.processChanges(allChanges)
+
+	equals(t, len(a.changes), 0)
+	equals(t, d2.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d2.UpdatedRestart, true)
+
+	d2.GenerationValue = 1
+	d2.RolloutCompleteValue = true
+	a.advanceWavePlans()
+
+	equals(t, len(a.wavePlans), 0)
+}
+
+func TestConfigChangesFailedWaveStopsRemainingRestarts(t *testing.T) {
+	a := agent()
+	a.settings.RestartWaves = []int{100}
+	a.settings.RestartWavesMinDeployments = 2
+	a.settings.RolloutTimeout = time.Minute
+	d1 := deploymentA()
+	d2 := deploymentB()
+	d2.AppliedChecksumsValue = map[string]string{configA().FullName(): configA().Checksum()}
+
+	observe(a, configA())
+	observe(a, d1)
+	observe(a, d2)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	d1.GenerationValue = 1
+	d1.RolloutFailedValue = true
+	a.advanceWavePlans()
+	a.processChanges(allChanges)
+
+	equals(t, a.wavePlans[configA().FullName()].Failed(), true)
+	equals(t, d2.UpdatedRestart, false)
+	equals(t, a.changes[d2.FullName()].HoldReason, holdReasonWave)
+}
+
+func TestConfigChangesWaveMemberWithShorterGracePeriodWaitsForItsWave(t *testing.T) {
+	a := agent()
+	a.settings.RestartWaves = []int{100}
+	a.settings.RestartWavesMinDeployments = 2
+	a.settings.RolloutTimeout = time.Minute
+	d1 := deploymentA()
+	d2 := deploymentB()
+	d2.AppliedChecksumsValue = map[string]string{configA().FullName(): configA().Checksum()}
+	d2.GracePeriodValue = durationOf(0)
+
+	observe(a, configA())
+	observe(a, d1)
+	observe(a, d2)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(func(change *Change, deployment *Deployment) bool {
+		return change.Ready(a.gracePeriods(deployment))
+	})
+
+	equals(t, len(a.wavePlans), 1)
+	equals(t, d1.UpdatedRestart, false) // grace period has not passed yet
+	equals(t, d2.UpdatedRestart, false)
+	equals(t, a.changes[d2.FullName()].HoldReason, holdReasonWave)
+}
+
+func TestConfigChangesHeldWaveStopsRemainingRestartsAfterRolloutTimeout(t *testing.T) {
+	a := agent()
+	a.settings.RestartWaves = []int{100}
+	a.settings.RestartWavesMinDeployments = 2
+	a.settings.RolloutTimeout = 10 * time.Millisecond
+	d1 := deploymentA()
+	d1.ApprovalRequiredValue = true
+	d2 := deploymentB()
+	d2.AppliedChecksumsValue = map[string]string{configA().FullName(): configA().Checksum()}
+
+	observe(a, configA())
+	observe(a, d1)
+	observe(a, d2)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, a.changes[d1.FullName()].HoldReason, holdReasonApproval)
+	equals(t, a.changes[d2.FullName()].HoldReason, holdReasonWave)
+
+	a.advanceWavePlans()
+	equals(t, a.wavePlans[configA().FullName()].Failed(), false)
+
+	time.Sleep(20 * time.Millisecond)
+	a.advanceWavePlans()
+	d1.ApprovedRestartValue = d1.UpdatedPendingRestartID
+	a.processChanges(allChanges)
+
+	equals(t, a.wavePlans[configA().FullName()].Failed(), true)
+	equals(t, d1.UpdatedRestart, false)
+	equals(t, d2.UpdatedRestart, false)
+	equals(t, a.changes[d2.FullName()].HoldReason, holdReasonWave)
+}
+
+func TestConfigChangesRolloutOutcomeIsRecordedWithTriggeringConfigs(t *testing.T) {
+	a := agent()
+	a.settings.RolloutTimeout = time.Minute
+	d := deploymentA()
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedRestart, true)
+	equals(t, d.UpdatedRolloutState, "progressing")
+	equals(t, d.UpdatedRolloutConfigs, []string{configA().FullName()})
+
+	a.trackRollouts()
+	equals(t, d.UpdatedRolloutState, "progressing")
+
+	d.GenerationValue = 1
+	d.RolloutFailedValue = true
+	a.trackRollouts()
+
+	equals(t, d.UpdatedRolloutState, "failed")
+	equals(t, d.UpdatedRolloutConfigs, []string{configA().FullName()})
+}
+
+func TestConfigChangesFailedRolloutOpensCircuitBreakerUntilReset(t *testing.T) {
+	a := agent()
+	a.settings.CircuitBreakerThreshold = 1
+	a.settings.MaxRestartsPerMinute = 1
+	a.settings.RolloutTimeout = time.Minute
+	d1 := deploymentA()
+	d2 := deploymentB()
+	d2.AppliedChecksumsValue = map[string]string{configA().FullName(): configA().Checksum()}
+
+	observe(a, configA())
+	observe(a, d1)
+	observe(a, d2)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	restarted, held := d1, d2
+	if d2.UpdatedRestart {
+		restarted, held = d2, d1
+	}
+	restarted.GenerationValue = 1
+	restarted.RolloutFailedValue = true
+	a.trackRollouts()
+	a.pruneCircuitBreakers()
+
+	equals(t, a.breakers[configA().FullName()].Open(), true)
+	equals(t, len(a.k8sClient.(*test.DummyK8sClient).Events), 1)
+
+	a.limiter.history = nil
+	a.processChanges(allChanges)
+
+	equals(t, held.UpdatedRestart, false)
+	equals(t, a.changes[held.FullName()].HoldReason, holdReasonBreaker)
+
+	reset := configAUpdated()
+	reset.VersionValue = "34567"
+	reset.BreakerResetValue = configAUpdated().Checksum()
+	observe(a, reset)
+	a.processChanges(allChanges)
+
+	equals(t, len(a.breakers), 0)
+	equals(t, held.UpdatedRestart, true)
+}
+
+func TestConfigChangesCircuitBreakerClosesWhenConfigChanges(t *testing.T) {
+	a := agent()
+	a.breakers[configA().FullName()] = NewCircuitBreaker(configA().FullName(), configA().Checksum())
+	a.breakers[configA().FullName()].RecordFailure("deployment/test/test-deployment", 1)
+
+	observe(a, configA())
+	a.pruneCircuitBreakers()
+	equals(t, len(a.breakers), 1)
+
+	observe(a, configAUpdated())
+	a.pruneCircuitBreakers()
+	equals(t, len(a.breakers), 0)
+}
+
+func TestConfigChangesRestartsOutsideOfRestartWindowAreDeferred(t *testing.T) {
+	a := agent()
+	a.settings.NamespaceRestartWindows = map[string]*util.Schedule{"test": schedule("0 0 30 2 *")}
+	d := deploymentA()
+	d.NamespaceValue = "test"
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+	a.updateChangeGaugeMetrics()
+
+	equals(t, d.UpdatedRestart, false)
+	equals(t, a.changes[d.FullName()].HoldReason, holdReasonDeferred)
+	equals(t, testutil.ToFloat64(RestartsDeferredTotal), float64(1))
+	equals(t, testutil.ToFloat64(ChangesWaitingTotal), float64(0))
+
+	d.RestartWindowValue = schedule("* * * * *") // the deployment window takes precedence
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedRestart, true)
+	equals(t, len(a.changes), 0)
+}
+
+func TestConfigChangesRestartsDuringRestartFreezeAreDeferred(t *testing.T) {
+	a := agent()
+	a.settings.RestartFreeze = schedule("* * * * *")
+	d := deploymentA()
+	d.RestartWindowValue = schedule("* * * * *")
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedRestart, false)
+	equals(t, a.changes[d.FullName()].HoldReason, holdReasonDeferred)
+}
+
+func TestConfigChangesRestartsOfDeploymentsWithInvalidRestartWindowAreHeld(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.RestartWindowError = errors.New("invalid restart window")
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+	a.processChanges(allChanges)
+	a.updateChangeGaugeMetrics()
+
+	equals(t, d.UpdatedRestart, false)
+	equals(t, a.changes[d.FullName()].HoldReason, holdReasonWindow)
+	equals(t, d.RecordedEvents, []string{"InvalidRestartWindow"})
+	equals(t, testutil.ToFloat64(RestartsInvalidWindowTotal), float64(1))
+
+	d.RestartWindowError = nil
+	a.processChanges(allChanges)
+	a.updateChangeGaugeMetrics()
+
+	equals(t, d.UpdatedRestart, true)
+	equals(t, len(a.changes), 0)
+	equals(t, testutil.ToFloat64(RestartsInvalidWindowTotal), float64(0))
+}
+
+func TestConfigChangesRestartsWaitForApproval(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.ApprovalRequiredValue = true
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	id := d.UpdatedPendingRestartID
+	equals(t, id != "", true)
+	equals(t, d.UpdatedPendingRestartConfigs, []string{configA().FullName()})
+	equals(t, d.UpdatedRestart, false)
+	equals(t, a.changes[d.FullName()].HoldReason, holdReasonApproval)
+
+	d.ApprovedRestartValue = "another-restart"
+	a.processChanges(allChanges)
+	equals(t, d.UpdatedRestart, false)
+
+	d.ApprovedRestartValue = id
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedRestart, true)
+	equals(t, d.UpdatedPendingRestartID, "")
+	equals(t, len(a.changes), 0)
+}
+
+func TestConfigChangesRestartsWaitingForApprovalAreApprovedAfterTimeout(t *testing.T) {
+	a := agent()
+	a.settings.ApprovalTimeout = time.Hour
+	d := deploymentA()
+	d.ApprovalRequiredValue = true
+	d.ApprovalTimeoutValue = durationOf(time.Millisecond)
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedRestart, false)
+
+	time.Sleep(2 * time.Millisecond)
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedRestart, true)
+}
+
+func TestConfigChangesRestartsPendingBeforeControllerRestartAreApprovedAfterTimeout(t *testing.T) {
+	a := agent()
+	a.settings.ApprovalTimeout = time.Hour
+	d := deploymentA()
+	d.ApprovalRequiredValue = true
+	d.PendingRestartIDValue = getSha(map[string]string{configA().FullName(): configAUpdated().Checksum()})
+	d.PendingRestartSinceValue = time.Now().Add(-2 * time.Hour)
+	d.UpdatedPendingRestartID = "unchanged"
+
+	observe(a, configAUpdated())
+	observe(a, d)
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedRestart, true)
+	equals(t, d.UpdatedPendingRestartID, "")
+}
+
+func TestConfigChangesRestartsApprovedWhileControllerWasDownClearPendingRestart(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.ApprovalRequiredValue = true
+	d.PendingRestartIDValue = getSha(map[string]string{configA().FullName(): configAUpdated().Checksum()})
+	d.PendingRestartSinceValue = time.Now()
+	d.ApprovedRestartValue = d.PendingRestartIDValue
+	d.UpdatedPendingRestartID = "unchanged"
+
+	observe(a, configAUpdated())
+	observe(a, d)
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedRestart, true)
+	equals(t, d.UpdatedPendingRestartID, "")
+	equals(t, len(a.changes), 0)
+}
+
+func TestConfigChangesAreAccumulatedWhilePaused(t *testing.T) {
+	a := agent()
+	a.settings.ControlConfigMap = "kube-system/deployment-restart-controller"
+	control := test.NewMetaConfigWithParams("configmap/kube-system/deployment-restart-controller", "1", "abc")
+	control.DataValue = map[string]string{"paused": "true"}
+	d := deploymentA()
+
+	observe(a, control)
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, a.control.Paused, true)
+	equals(t, d.UpdatedChecksums, map[string]string(nil))
+	equals(t, len(a.changes), 3)
+
+	resumed := test.NewMetaConfigWithParams(control.FullName(), "2", "def")
+	resumed.DataValue = map[string]string{"paused": "false"}
+	observe(a, resumed)
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, true)
+	equals(t, len(a.changes), 0)
+}
+
+func TestConfigChangesOfDeploymentsInPausedNamespacesAreHeldBack(t *testing.T) {
+	a := agent()
+	a.settings.ControlConfigMap = "kube-system/deployment-restart-controller"
+	control := test.NewMetaConfigWithParams("configmap/kube-system/deployment-restart-controller", "1", "abc")
+	control.DataValue = map[string]string{"paused-namespaces": "test"}
+	d := deploymentA()
+	d.NamespaceValue = "test"
+
+	observe(a, control)
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedChecksums, map[string]string(nil))
+	equals(t, a.changes[d.FullName()].HoldReason, holdReasonPaused)
+	equals(t, a.changes[d.FullName()].Restart, false)
+
+	a.cleanupConfig(control) // deleting the control ConfigMap resumes updates
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, true)
+}
+
+func TestConfigChangesForceRestartOfConfigRestartsAllConsumers(t *testing.T) {
+	a := agent()
+	d1 := deploymentA()
+	d2 := deploymentB()
+	d2.AppliedChecksumsValue = map[string]string{configA().FullName(): configA().Checksum()}
+
+	observe(a, configA())
+	observe(a, d1)
+	observe(a, d2)
+	a.processChanges(allChanges)
+
+	forcedRestarts := testutil.ToFloat64(ForcedRestartsTotal)
+	forced := configA()
+	forced.VersionValue = "23456"
+	forced.ForceRestartTriggerValue = "2026-10-19T10:00:00Z"
+	observe(a, forced)
+	a.processChanges(allChanges)
+
+	equals(t, d1.UpdatedRestart, true)
+	equals(t, d1.UpdatedRolloutConfigs, []string{configA().FullName()})
+	equals(t, d2.UpdatedRestart, true)
+	equals(t, testutil.ToFloat64(ForcedRestartsTotal)-forcedRestarts, float64(2))
+	equals(t, a.configs[configA().FullName()].ForcedRestart(), false)
+
+	patches := a.k8sClient.(*test.DummyK8sClient).Patches
+	equals(t, len(patches), 1)
+	equals(t, patches[0].Path, configA().FullName())
+
+	// the acknowledged trigger is not acted on again until the annotation is removed
+	d1.UpdatedRestart = false
+	forced.VersionValue = "34567"
+	observe(a, forced)
+	a.processChanges(allChanges)
+
+	equals(t, d1.UpdatedRestart, false)
+}
+
+func TestConfigChangesForceRestartOfConfigIsKeptUntilAllConsumersAreRestarted(t *testing.T) {
+	a := agent()
+	a.settings.MaxRestartsPerMinute = 1
+	d1 := deploymentA()
+	d2 := deploymentB()
+	d2.AppliedChecksumsValue = map[string]string{configA().FullName(): configA().Checksum()}
+
+	observe(a, configA())
+	observe(a, d1)
+	observe(a, d2)
+	a.processChanges(allChanges)
+
+	forced := configA()
+	forced.VersionValue = "23456"
+	forced.ForceRestartTriggerValue = "2026-10-19T10:00:00Z"
+	observe(a, forced)
+	a.processChanges(allChanges)
+
+	throttled := d2
+	if d2.UpdatedRestart {
+		throttled = d1
+	}
+	equals(t, d1.UpdatedRestart != d2.UpdatedRestart, true)
+	equals(t, a.changes[throttled.FullName()].HoldReason, holdReasonThrottled)
+	equals(t, len(a.k8sClient.(*test.DummyK8sClient).Patches), 0)
+
+	a.settings.MaxRestartsPerMinute = 0
+	a.processChanges(allChanges)
+
+	equals(t, throttled.UpdatedRestart, true)
+	patches := a.k8sClient.(*test.DummyK8sClient).Patches
+	equals(t, len(patches), 1)
+	equals(t, patches[0].Path, configA().FullName())
+}
+
+func TestConfigChangesForceRestartOfDeploymentRestartsIt(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+
+	observe(a, configA())
+	observe(a, configB())
+	observe(a, d)
+	a.processChanges(allChanges)
+	equals(t, d.UpdatedRestart, false)
+
+	forced := deploymentAUpdated()
+	forced.ForceRestartTriggerValue = "now"
+	observe(a, forced)
+	a.processChanges(allChanges)
+
+	equals(t, forced.UpdatedRestart, true)
+	equals(t, forced.UpdatedRolloutConfigs, []string(nil))
+	equals(t, forced.ClearedForceRestartTrigger, true)
+	equals(t, a.deployments[d.FullName()].ForcedRestart, false)
+	equals(t, len(a.changes), 0)
+}
+
+func TestConfigChangesDoNotRestartDeploymentsRolledOutAfterTheChange(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.TemplateChecksumValue = "abc"
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+
+	rolledOut := deploymentAUpdated()
+	rolledOut.TemplateChecksumValue = "bcd"
+	observe(a, rolledOut)
+	a.processChanges(allChanges)
+
+	equals(t, rolledOut.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, rolledOut.UpdatedRestart, false)
+	equals(t, len(a.changes), 0)
+}
+
+func TestConfigChangesRestartDeploymentsRolledOutBeforeTheChange(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.TemplateChecksumValue = "abc"
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+
+	rolledOut := deploymentAUpdated()
+	rolledOut.TemplateChecksumValue = "bcd"
+	observe(a, rolledOut)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, rolledOut.UpdatedRestart, true)
+}
+
+func TestConfigChangesOfDeploymentsScaledToZeroSaveChecksumsWithoutRestart(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.ScaledToZeroValue = true
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, false)
+	equals(t, len(a.changes), 0)
+}
+
+func TestConfigChangesRestartsOfPausedDeploymentsAreDeferredUntilResumed(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.RolloutPausedValue = true
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+	a.processChanges(allChanges)
+	a.updateChangeGaugeMetrics()
+
+	equals(t, d.UpdatedChecksums, map[string]string(nil))
+	equals(t, a.changes[d.FullName()].HoldReason, holdReasonResume)
+	equals(t, d.RecordedEvents, []string{"ConfigRestartDeferred"})
+	equals(t, testutil.ToFloat64(RestartsWaitingForResumeTotal), float64(1))
+
+	d.RolloutPausedValue = false
+	a.processChanges(allChanges)
+	a.updateChangeGaugeMetrics()
+
+	equals(t, d.UpdatedChecksums[configA().FullName()], configAUpdated().Checksum())
+	equals(t, d.UpdatedRestart, true)
+	equals(t, testutil.ToFloat64(RestartsWaitingForResumeTotal), float64(0))
+}
+
+func TestConfigChangesRestartsAreCountedPerNamespaceKindAndTrigger(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.NamespaceValue = "test"
+	restarts := DeploymentRestartsTotal.WithLabelValues("test", "deployment", triggerConfig)
+	updates := DeploymentAnnotationUpdatesTotal.WithLabelValues("test", "deployment", triggerConfig)
+	configRestarts := ConfigRestartsTotal.WithLabelValues(configA().FullName(), "")
+	before := []float64{testutil.ToFloat64(restarts), testutil.ToFloat64(updates), testutil.ToFloat64(configRestarts)}
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, testutil.ToFloat64(restarts)-before[0], float64(1))
+	equals(t, testutil.ToFloat64(updates)-before[1], float64(1))
+	equals(t, testutil.ToFloat64(configRestarts)-before[2], float64(1))
+}
+
+func TestConfigChangesFailedUpdatesAreNotCounted(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.NamespaceValue = "failing"
+	d.UpdateError = errors.New("ignore-me")
+	updates := DeploymentAnnotationUpdatesTotal.WithLabelValues("failing", "deployment", triggerConfig)
+	before := testutil.ToFloat64(updates)
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, testutil.ToFloat64(updates)-before, float64(0))
+}
+
+func TestConfigChangesRestartsAreCountedPerConfigAndWorkloadWhenEnabled(t *testing.T) {
+	a := agent()
+	a.settings.MetricsWorkloadLabels = true
+	d := deploymentA()
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	observe(a, configAUpdated())
+	a.processChanges(allChanges)
+
+	equals(t, testutil.ToFloat64(ConfigRestartsTotal.WithLabelValues(configA().FullName(), d.FullName())), float64(1))
+
+	a.cleanupDeployment(d)
+	equals(t, testutil.ToFloat64(ConfigRestartsTotal.WithLabelValues(configA().FullName(), d.FullName())), float64(0))
+}
+
+func TestUpdateTriggerTellsWhatCausedTheUpdate(t *testing.T) {
+	d := NewDeployment(deploymentA())
+
+	equals(t, updateTrigger(d, d.AppliedChecksums, nil), triggerDeployment)
+	equals(t, updateTrigger(d, map[string]string{configA().FullName(): "changed"}, nil), triggerConfig)
+	equals(t, updateTrigger(d, d.AppliedChecksums, []string{configA().FullName()}), triggerConfig)
+
+	d.ForcedRestart = true
+	equals(t, updateTrigger(d, d.AppliedChecksums, []string{configA().FullName()}), triggerForced)
+}
+
+func TestConfigChangesAgeOfOldestWaitingChangeIsExposed(t *testing.T) {
+	a := agent()
+	a.settings.RestartGracePeriod = time.Hour
+	d := deploymentA()
+
+	observe(a, configA())
+	observe(a, d)
+	a.changes[configA().FullName()].createdAt = time.Now().Add(-time.Minute)
+	a.updateChangeGaugeMetrics()
+
+	equals(t, testutil.ToFloat64(OldestChangeAgeSeconds) >= 60, true)
+
+	a.processChanges(allChanges)
+	a.updateChangeGaugeMetrics()
+
+	equals(t, testutil.ToFloat64(OldestChangeAgeSeconds), float64(0))
+}
+
 func TestConfigChangesProcessStopsOnError(t *testing.T) {
 	a := agent()
 	c := configAUpdated()
@@ -428,6 +1410,168 @@ func TestConfigChangesProcessContinuesOnIgnoredErrors(t *testing.T) {
 	equals(t, d.UpdatedRestart, true)
 }
 
+func TestDeploymentsOutsideWatchedNamespacesAreIgnored(t *testing.T) {
+	a := agent()
+	a.settings.Namespaces = []string{"other"}
+	d := deploymentA()
+	d.NamespaceValue = "test"
+
+	observe(a, d)
+
+	equals(t, len(a.deployments), 0)
+	equals(t, len(a.changes), 0)
+}
+
+func TestDeploymentsOfOtherControllerClassesAreIgnored(t *testing.T) {
+	a := agent()
+	a.settings.ControllerClass = "web"
+	d := deploymentA()
+	b := deploymentB()
+	b.ControllerClassValue = "web"
+
+	observe(a, d)
+	observe(a, b)
+
+	equals(t, len(a.deployments), 1)
+	equals(t, a.deployments[b.FullName()] != nil, true)
+}
+
+func TestDeploymentsNotMatchingTheSelectorAreIgnored(t *testing.T) {
+	a := agent()
+	a.settings.Selector, _ = ParseSelector("team=web")
+	d := deploymentA()
+	d.LabelsValue = map[string]string{"team": "db"}
+	b := deploymentB()
+	b.LabelsValue = map[string]string{"team": "web"}
+
+	observe(a, d)
+	observe(a, b)
+
+	equals(t, len(a.deployments), 1)
+	equals(t, a.deployments[b.FullName()] != nil, true)
+}
+
+func TestApplySettingsCleansUpDeploymentsNoLongerWatched(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	d.NamespaceValue = "test"
+	a.knownVersion(configA())
+	a.knownVersion(d)
+	observe(a, configA())
+	observe(a, d)
+
+	settings := a.settings
+	settings.Namespaces = []string{"other"}
+	a.applySettings(settings)
+
+	equals(t, len(a.deployments), 0)
+	equals(t, a.settings.Namespaces, []string{"other"})
+	equals(t, a.knownVersion(configA()), true)
+	equals(t, a.knownVersion(d), false)
+}
+
+func TestApplySettingsForgetsVersionsOfDeploymentsNotTracked(t *testing.T) {
+	a := agent()
+	a.settings.Selector, _ = ParseSelector("team=web")
+	d := deploymentA()
+	a.knownVersion(d)
+	observe(a, d)
+	equals(t, len(a.deployments), 0)
+
+	settings := a.settings
+	settings.Selector = nil
+	a.applySettings(settings)
+
+	// The next delivery of the deployment by the informers tracks it
+	equals(t, a.knownVersion(d), false)
+	observe(a, d)
+	equals(t, len(a.deployments), 1)
+}
+
+func TestApplySettingsForgetsAllVersionsWhenAnnotationsChange(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+	observe(a, configA())
+	observe(a, d)
+
+	settings := a.settings
+	settings.Annotations, _ = NewAnnotations("platform.example.com/restart", DefaultAnnotationPrefix)
+	a.applySettings(settings)
+
+	equals(t, a.knownVersion(configA()), false)
+	equals(t, a.knownVersion(d), false)
+}
+
+func TestUpdateSettingsOfARunningAgent(t *testing.T) {
+	a := agent()
+	a.Start(make(chan struct{}))
+	defer a.Stop()
+
+	settings := a.settings
+	settings.RestartGracePeriod = time.Minute
+	a.UpdateSettings(settings)
+
+	snapshot, err := a.Snapshot(interfaces.SnapshotFilter{})
+	equals(t, err, nil)
+	equals(t, len(snapshot.Deployments), 0)
+	equals(t, a.settings.RestartGracePeriod, time.Minute)
+}
+
+// agentWithNewDeployment returns an agent that has processed the addition of configA and
+// observed deploymentA referencing it, but has not processed the deployment change yet
+func agentWithNewDeployment() (*RealConfigAgent, *test.DummyMetaDeployment) {
+	a := agent()
+	d := deploymentA()
+	delete(d.AppliedChecksumsValue, configA().FullName())
+
+	observe(a, configA())
+	a.processChanges(allChanges)
+	observe(a, d)
+
+	return a, d
+}
+
+// agentWithDeletedConfig returns an agent that has processed deploymentA referencing
+// configA, followed by the deletion of configA
+func agentWithDeletedConfig() *RealConfigAgent {
+	a := agent()
+	a.settings.ConfigTombstonePeriod = time.Minute
+	d := deploymentA()
+	d.ReferencedConfigsValue = []string{configA().FullName()}
+	d.AppliedChecksumsValue = map[string]string{configA().FullName(): configA().Checksum()}
+
+	observe(a, configA())
+	observe(a, d)
+	a.processChanges(allChanges)
+	a.cleanupConfig(configA())
+	a.cleanupVersion(configA())
+
+	return a
+}
+
+// observe tracks a resource bypassing the update loop, so that tests can control the order
+// in which changes get processed
+func observe(a *RealConfigAgent, res interfaces.MetaResource) {
+	time.Sleep(time.Millisecond) // keep observation timestamps apart
+	switch v := res.(type) {
+	case interfaces.MetaConfig:
+		a.trackConfig(v)
+	case interfaces.MetaDeployment:
+		a.trackDeployment(v)
+	}
+}
+
+func allChanges(*Change, *Deployment) bool { return true }
+
+func changesOf(resource string) func(*Change, *Deployment) bool {
+	return func(change *Change, _ *Deployment) bool { return change.Resource == resource }
+}
+
+func schedule(spec string) *util.Schedule {
+	schedule, _ := util.ParseSchedule(spec)
+	return schedule
+}
+
 func configA() *test.DummyMetaConfig {
 	return test.NewMetaConfigWithParams("configmap/test/test", "12345", "abc")
 }
@@ -453,6 +1597,14 @@ func deploymentA() *test.DummyMetaDeployment {
 	return d
 }
 
+// deploymentWithoutAppliedChecksums returns deploymentA as created, before the controller
+// recorded any checksums on it
+func deploymentWithoutAppliedChecksums() *test.DummyMetaDeployment {
+	d := deploymentA()
+	d.AppliedChecksumsValue = nil
+	return d
+}
+
 func deploymentAUpdated() *test.DummyMetaDeployment {
 	d := deploymentA()
 	d.VersionValue = "23456"
@@ -468,11 +1620,19 @@ func deploymentB() *test.DummyMetaDeployment {
 	return d
 }
 
+func durationOf(value time.Duration) *time.Duration {
+	return &value
+}
+
 func agent() *RealConfigAgent {
 	// flag.Set("logtostderr", "true")
 	// flag.Set("v", "3")
 	// flag.CommandLine.Parse([]string{})
-	agent := NewConfigAgent(util.Clientset(), 20*time.Millisecond, 100*time.Millisecond, []string{"ignore-me"}).(*RealConfigAgent)
+	agent := NewConfigAgent(util.Clientset(), Settings{
+		RestartCheckPeriod: 20 * time.Millisecond,
+		RestartGracePeriod: 100 * time.Millisecond,
+		IgnoredErrors:      []string{"ignore-me"},
+	}).(*RealConfigAgent)
 	agent.k8sClient = test.NewDummyK8sClient()
 	return agent
 }
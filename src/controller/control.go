@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	controlPausedKey           = "paused"
+	controlPausedNamespacesKey = "paused-namespaces"
+)
+
+// ControlState holds the settings read from the control ConfigMap of the controller
+type ControlState struct {
+	// Paused stops all updates of deployments
+	Paused bool
+	// PausedNamespaces stops updates of deployments in the namespaces
+	PausedNamespaces map[string]struct{}
+}
+
+// ControlStateFromData parses the data of the control ConfigMap. The "paused" key holds a
+// boolean, and the "paused-namespaces" key a list of namespaces separated by commas or
+// whitespace
+func ControlStateFromData(data map[string]string) ControlState {
+	state := ControlState{PausedNamespaces: make(map[string]struct{})}
+
+	state.Paused, _ = strconv.ParseBool(strings.TrimSpace(data[controlPausedKey]))
+
+	separators := func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' }
+	for _, namespace := range strings.FieldsFunc(data[controlPausedNamespacesKey], separators) {
+		state.PausedNamespaces[namespace] = struct{}{}
+	}
+
+	return state
+}
+
+// PausesNamespace returns true if updates of deployments in the namespace are stopped
+func (s ControlState) PausesNamespace(namespace string) bool {
+	if s.Paused {
+		return true
+	}
+	_, ok := s.PausedNamespaces[namespace]
+	return ok
+}
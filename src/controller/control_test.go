@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"testing"
+)
+
+func TestControlStateFromDataParsesPauseSettings(t *testing.T) {
+	state := ControlStateFromData(map[string]string{
+		"paused":            "false",
+		"paused-namespaces": "one, two\nthree",
+	})
+
+	equals(t, state.Paused, false)
+	equals(t, state.PausesNamespace("one"), true)
+	equals(t, state.PausesNamespace("three"), true)
+	equals(t, state.PausesNamespace("four"), false)
+
+	state = ControlStateFromData(map[string]string{"paused": "true"})
+
+	equals(t, state.Paused, true)
+	equals(t, state.PausesNamespace("four"), true)
+}
+
+func TestControlStateFromDataIgnoresInvalidValues(t *testing.T) {
+	state := ControlStateFromData(map[string]string{"paused": "maybe"})
+
+	equals(t, state.Paused, false)
+	equals(t, len(state.PausedNamespaces), 0)
+}
@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
@@ -21,34 +24,143 @@ import (
 type DeploymentConfigController struct {
 	Stop chan struct{}
 
-	configAgent interfaces.ConfigAgent
-	factory     informers.SharedInformerFactory
+	configAgent     interfaces.ConfigAgent
+	factory         informers.SharedInformerFactory
+	informersSynced []cache.InformerSynced
+	stores          []cache.Store
+
+	// livenessTimeout is a time.Duration, updated with the settings while health checks
+	// read it
+	livenessTimeout atomic.Int64
+	// annotations are updated with the settings while the informers convert resources
+	annotations atomic.Pointer[Annotations]
+}
+
+// settingsUpdater is implemented by config agents able to replace their settings at runtime
+type settingsUpdater interface {
+	UpdateSettings(settings Settings)
 }
 
 // NewDeploymentConfigController creates a new instance of DeploymentConfigController
-func NewDeploymentConfigController(restartCheckPeriod time.Duration, restartGracePeriod time.Duration, ignoredErrors []string) *DeploymentConfigController {
+func NewDeploymentConfigController(settings Settings) *DeploymentConfigController {
 	k8sClient := util.Clientset()
 	factory := informers.NewSharedInformerFactory(k8sClient, 5*time.Minute)
 
 	dcc := &DeploymentConfigController{
-		configAgent: NewConfigAgent(k8sClient, restartCheckPeriod, restartGracePeriod, ignoredErrors),
+		configAgent: NewConfigAgent(k8sClient, settings),
 		factory:     factory,
 		Stop:        make(chan struct{}),
 	}
+	dcc.livenessTimeout.Store(int64(settings.LivenessTimeout))
+	dcc.annotations.Store(&settings.Annotations)
 
 	handlers := cache.ResourceEventHandlerFuncs{
 		AddFunc:    dcc.addResource,
 		UpdateFunc: dcc.updateResource,
 		DeleteFunc: dcc.deleteResource,
 	}
-	factory.Core().V1().ConfigMaps().Informer().AddEventHandler(handlers)
-	factory.Core().V1().Secrets().Informer().AddEventHandler(handlers)
-	factory.Apps().V1().Deployments().Informer().AddEventHandler(handlers)
-	factory.Apps().V1().StatefulSets().Informer().AddEventHandler(handlers)
+	for _, informer := range []cache.SharedIndexInformer{
+		factory.Core().V1().ConfigMaps().Informer(),
+		factory.Core().V1().Secrets().Informer(),
+		factory.Apps().V1().Deployments().Informer(),
+		factory.Apps().V1().StatefulSets().Informer(),
+	} {
+		informer.AddEventHandler(handlers)
+		dcc.informersSynced = append(dcc.informersSynced, informer.HasSynced)
+		dcc.stores = append(dcc.stores, informer.GetStore())
+	}
 
 	return dcc
 }
 
+// Healthy returns an error if the update loop of the config agent is not running or has
+// not processed changes within the liveness timeout, e.g. because it is blocked
+func (c *DeploymentConfigController) Healthy() error {
+	lastActivity := c.configAgent.LastActivity()
+	if lastActivity.IsZero() {
+		return errors.New("update loop is not running")
+	}
+
+	timeout := time.Duration(c.livenessTimeout.Load())
+	if inactive := time.Since(lastActivity); timeout > 0 && inactive > timeout {
+		return fmt.Errorf("update loop is inactive for %s", inactive.Round(time.Second))
+	}
+
+	return nil
+}
+
+// UpdateSettings applies settings changed at runtime. Settings of the informers and of the
+// HTTP endpoints are not affected. The resources known to the informers are passed to the
+// config agent again, so that deployments watched now are tracked without waiting for the
+// next resync. The agent skips resources whose versions it knows already
+func (c *DeploymentConfigController) UpdateSettings(settings Settings) {
+	c.livenessTimeout.Store(int64(settings.LivenessTimeout))
+	c.annotations.Store(&settings.Annotations)
+	if agent, ok := c.configAgent.(settingsUpdater); ok {
+		agent.UpdateSettings(settings)
+	}
+
+	for _, store := range c.stores {
+		for _, obj := range store.List() {
+			c.addResource(obj)
+		}
+	}
+}
+
+// ServeCatalog responds with a JSON snapshot of the catalog and the change queue of the
+// config agent, optionally filtered by the namespace and workload query parameters
+func (c *DeploymentConfigController) ServeCatalog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	snapshot, err := c.configAgent.Snapshot(interfaces.SnapshotFilter{
+		Namespace: query.Get("namespace"),
+		Workload:  query.Get("workload"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// ServeGraph responds with the dependency graph of configs and deployments, in the DOT
+// language if the format query parameter is dot, otherwise as JSON. The graph can be
+// restricted by the namespace, config and workload query parameters
+func (c *DeploymentConfigController) ServeGraph(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	snapshot, err := c.configAgent.Snapshot(interfaces.SnapshotFilter{
+		Namespace: query.Get("namespace"),
+		Workload:  query.Get("workload"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	graph := NewGraph(snapshot, GraphFilter{Config: query.Get("config"), Workload: query.Get("workload")})
+	if query.Get("format") == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		fmt.Fprint(w, graph.DOT())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
+
+// Ready returns an error until the informers have synced all resources. The controller
+// runs as a single replica without leader election, so there is no standby state
+func (c *DeploymentConfigController) Ready() error {
+	for _, synced := range c.informersSynced {
+		if !synced() {
+			return errors.New("informers have not synced yet")
+		}
+	}
+
+	return nil
+}
+
 // Run starts the controller loop
 func (c *DeploymentConfigController) Run() (err error) {
 	defer glog.Flush()
@@ -73,7 +185,7 @@ func (c *DeploymentConfigController) Run() (err error) {
 }
 
 func (c *DeploymentConfigController) addResource(obj interface{}) {
-	res, err := convertToMetaResource(obj)
+	res, err := convertToMetaResource(obj, *c.annotations.Load())
 	if err == nil {
 		c.configAgent.ResourceUpdated(res)
 	} else {
@@ -82,7 +194,7 @@ func (c *DeploymentConfigController) addResource(obj interface{}) {
 }
 
 func (c *DeploymentConfigController) updateResource(oldObj, newObj interface{}) {
-	res, err := convertToMetaResource(newObj)
+	res, err := convertToMetaResource(newObj, *c.annotations.Load())
 	if err == nil {
 		c.configAgent.ResourceUpdated(res)
 	} else {
@@ -91,7 +203,7 @@ func (c *DeploymentConfigController) updateResource(oldObj, newObj interface{})
 }
 
 func (c *DeploymentConfigController) deleteResource(obj interface{}) {
-	res, err := convertToMetaResource(obj)
+	res, err := convertToMetaResource(obj, *c.annotations.Load())
 	if err == nil {
 		c.configAgent.ResourceDeleted(res)
 	} else {
@@ -99,18 +211,18 @@ func (c *DeploymentConfigController) deleteResource(obj interface{}) {
 	}
 }
 
-func convertToMetaResource(obj interface{}) (interfaces.MetaResource, error) {
+func convertToMetaResource(obj interface{}, annotations Annotations) (interfaces.MetaResource, error) {
 	switch v := obj.(type) {
 	case *core.ConfigMap:
-		return MetaConfigFromConfigMap(v), nil
+		return MetaConfigFromConfigMap(v, annotations), nil
 	case *core.Secret:
-		return MetaConfigFromSecret(v), nil
+		return MetaConfigFromSecret(v, annotations), nil
 	case *apps.Deployment:
-		return MetaDeploymentFromDeployment(v), nil
+		return MetaDeploymentFromDeployment(v, annotations), nil
 	case *apps.StatefulSet:
-		return MetaDeploymentFromStatefulSet(v), nil
+		return MetaDeploymentFromStatefulSet(v, annotations), nil
 	case cache.DeletedFinalStateUnknown: // the deletion event was missed by the watch
-		return convertToMetaResource(v.Obj)
+		return convertToMetaResource(v.Obj, annotations)
 	}
 	return nil, fmt.Errorf("Unhandled type: %T", obj)
 }
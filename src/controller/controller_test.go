@@ -1,11 +1,16 @@
 package controller
 
 import (
+	"errors"
 	"flag"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/test"
 	"k8s.io/client-go/tools/cache"
 )
@@ -148,8 +153,104 @@ func TestDeletingUnknownResourceDoesNothing(t *testing.T) {
 	equals(t, len(getDummyAgent(c).DeletedResources), 0)
 }
 
+func TestHealthyFailsUntilUpdateLoopIsActive(t *testing.T) {
+	c := controller()
+	c.livenessTimeout.Store(int64(time.Minute))
+
+	equals(t, c.Healthy() != nil, true)
+
+	getDummyAgent(c).LastActivityValue = time.Now().Add(-2 * time.Minute)
+	equals(t, c.Healthy() != nil, true)
+
+	getDummyAgent(c).LastActivityValue = time.Now()
+	equals(t, c.Healthy(), nil)
+}
+
+func TestUpdateSettingsChangesTheLivenessTimeout(t *testing.T) {
+	c := controller()
+	c.livenessTimeout.Store(int64(time.Minute))
+	getDummyAgent(c).LastActivityValue = time.Now().Add(-2 * time.Minute)
+
+	c.UpdateSettings(Settings{LivenessTimeout: 5 * time.Minute})
+
+	equals(t, c.Healthy(), nil)
+}
+
+func TestUpdateSettingsPassesKnownResourcesToTheAgentAgain(t *testing.T) {
+	c := controller()
+	c.stores[0].Add(newConfigMap("test", "one", "", nil))
+
+	c.UpdateSettings(Settings{})
+
+	equals(t, len(getDummyAgent(c).UpdatedResources), 1)
+	equals(t, getDummyAgent(c).UpdatedResources[0].FullName(), "configmap/test/one")
+}
+
+func TestUpdateSettingsConvertsResourcesWithTheNewAnnotations(t *testing.T) {
+	c := controller()
+	c.stores[0].Add(newConfigMap("test", "one", "", nil))
+	settings := Settings{}
+	settings.Annotations, _ = NewAnnotations("platform.example.com/restart", "")
+
+	c.UpdateSettings(settings)
+
+	config := getDummyAgent(c).UpdatedResources[0].(*metaConfig)
+	equals(t, config.annotations.Prefix(), "platform.example.com/restart")
+}
+
+func TestReadyFailsUntilInformersSynced(t *testing.T) {
+	c := controller()
+	synced := false
+	c.informersSynced = []cache.InformerSynced{func() bool { return true }, func() bool { return synced }}
+
+	equals(t, c.Ready() != nil, true)
+
+	synced = true
+	equals(t, c.Ready(), nil)
+}
+
+func TestServeCatalogRespondsWithFilteredSnapshot(t *testing.T) {
+	c := controller()
+	getDummyAgent(c).SnapshotValue = interfaces.Snapshot{Changes: []interfaces.ChangeSnapshot{{Resource: "configmap/test/one"}}}
+
+	response := httptest.NewRecorder()
+	c.ServeCatalog(response, httptest.NewRequest("GET", "/debug/catalog?namespace=test", nil))
+
+	equals(t, response.Code, http.StatusOK)
+	equals(t, getDummyAgent(c).SnapshotFilter, interfaces.SnapshotFilter{Namespace: "test"})
+	equals(t, strings.Contains(response.Body.String(), `"resource":"configmap/test/one"`), true)
+
+	getDummyAgent(c).SnapshotError = errors.New("update loop did not respond in time")
+	response = httptest.NewRecorder()
+	c.ServeCatalog(response, httptest.NewRequest("GET", "/debug/catalog", nil))
+
+	equals(t, response.Code, http.StatusServiceUnavailable)
+}
+
+func TestServeGraphRespondsWithDOTOrJSON(t *testing.T) {
+	c := controller()
+	getDummyAgent(c).SnapshotValue = graphSnapshot()
+
+	response := httptest.NewRecorder()
+	c.ServeGraph(response, httptest.NewRequest("GET", "/debug/graph?format=dot&config=secret/test/two", nil))
+
+	equals(t, response.Code, http.StatusOK)
+	equals(t, strings.Contains(response.Body.String(), `"secret/test/two" -> "deployment/test/a";`), true)
+	equals(t, strings.Contains(response.Body.String(), "configmap/test/one"), false)
+
+	response = httptest.NewRecorder()
+	c.ServeGraph(response, httptest.NewRequest("GET", "/debug/graph?workload=deployment/test/a", nil))
+
+	equals(t, getDummyAgent(c).SnapshotFilter, interfaces.SnapshotFilter{Workload: "deployment/test/a"})
+	equals(t, strings.Contains(response.Body.String(), `{"config":"secret/test/two","workload":"deployment/test/a"}`), true)
+}
+
 func controller() *DeploymentConfigController {
-	controller := NewDeploymentConfigController(100*time.Millisecond, 1*time.Second, []string{})
+	controller := NewDeploymentConfigController(Settings{
+		RestartCheckPeriod: 100 * time.Millisecond,
+		RestartGracePeriod: 1 * time.Second,
+		Annotations:        DefaultAnnotations(),
+	})
 	controller.configAgent = test.NewDummyConfigAgent()
 	return controller
 }
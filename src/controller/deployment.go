@@ -1,36 +1,132 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/golang/glog"
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
 )
 
-// Deployment stores a MetaDeployment instance and a map of configs referenced by it
+// Deployment stores a MetaDeployment instance, a map of configs referenced by it and a map
+// of tombstones of referenced configs that were deleted
 type Deployment struct {
 	meta             interfaces.MetaDeployment
 	Configs          map[string]*Config
 	AppliedChecksums map[string]string
+	Tombstones       map[string]*Tombstone
+	RestartedConfigs []string
+
+	templateChecksum  string
+	templateChangedAt time.Time
+	changeObservedAt  time.Time
+	specObservedAt    time.Time
+
+	restartedAt         time.Time
+	restartedGeneration int64
+	rolloutReported     bool
+
+	pendingRestartID    string
+	pendingRestartSince time.Time
+
+	// ForcedRestart is set when a restart was requested by a force restart annotation of
+	// the deployment or of one of its configs
+	ForcedRestart       bool
+	forcedConfigs       []string
+	acknowledgedTrigger string
 }
 
 // NewDeployment creates a new deployment with a bound MetaDeployment object
 func NewDeployment(meta interfaces.MetaDeployment) *Deployment {
-	return &Deployment{
+	deployment := &Deployment{
 		meta:             meta,
 		Configs:          make(map[string]*Config),
 		AppliedChecksums: meta.AppliedChecksums(),
+		Tombstones:       make(map[string]*Tombstone),
+		templateChecksum: meta.TemplateChecksum(),
 	}
+	deployment.observeForceRestartTrigger()
+	deployment.observePendingRestart()
+	return deployment
 }
 
-// UpdateFromMeta replaces the underlying MetaDeployment object and populates
-// AppliedChecksums. Returns true if referenced configs or config checksums changed,
-// otherwise returns false
+// UpdateFromMeta replaces the underlying MetaDeployment object, populates AppliedChecksums
+// and tracks changes of the pod template. Returns true if referenced configs or config
+// checksums changed, or if a restart was requested, otherwise returns false
 func (d *Deployment) UpdateFromMeta(meta interfaces.MetaDeployment) bool {
 	configInfoChanged := !stringSlicesEqual(d.meta.ReferencedConfigs(), meta.ReferencedConfigs()) || !stringMapsEqual(d.AppliedChecksums, meta.AppliedChecksums())
 
 	d.meta = meta
 	d.AppliedChecksums = meta.AppliedChecksums()
+	if checksum := meta.TemplateChecksum(); checksum != d.templateChecksum {
+		d.templateChecksum = checksum
+		d.templateChangedAt = time.Now()
+	}
+	triggered := d.observeForceRestartTrigger()
+	d.observePendingRestart()
+
+	return configInfoChanged || triggered
+}
+
+// TemplateChangedAfter returns true if a change of the pod template was observed after the
+// given time. Such a change rolls out the deployment with the configs current at that time
+func (d *Deployment) TemplateChangedAfter(t time.Time) bool {
+	return d.templateChangedAt.After(t)
+}
+
+// ForceRestart requests a restart of the deployment due to a force restart annotation of
+// the config
+func (d *Deployment) ForceRestart(configName string) {
+	d.ForcedRestart = true
+	if !containsString(d.forcedConfigs, configName) {
+		d.forcedConfigs = append(d.forcedConfigs, configName)
+	}
+}
+
+// ForcedConfigs returns the configs whose force restart annotations requested a restart
+func (d *Deployment) ForcedConfigs() []string {
+	return d.forcedConfigs
+}
+
+// AcknowledgeForcedRestart marks the requested restart as done and removes the force restart
+// annotation of the deployment, if any
+func (d *Deployment) AcknowledgeForcedRestart(c interfaces.K8sClient) error {
+	d.ForcedRestart = false
+	d.forcedConfigs = nil
+
+	trigger := d.meta.ForceRestartTrigger()
+	if trigger == "" || trigger == d.acknowledgedTrigger {
+		return nil
+	}
+
+	d.acknowledgedTrigger = trigger
+	return d.meta.ClearForceRestartTrigger(c)
+}
+
+func (d *Deployment) observeForceRestartTrigger() bool {
+	trigger := d.meta.ForceRestartTrigger()
+	if trigger == "" || trigger == d.acknowledgedTrigger || d.ForcedRestart {
+		return false
+	}
+
+	d.ForcedRestart = true
+	return true
+}
+
+// observePendingRestart restores the restart waiting for approval from the k8s resource, so
+// that the approval timeout keeps counting across controller restarts. The known pending
+// restart is kept if the resource does not name one yet, e.g. until the patch requesting
+// the approval is observed
+func (d *Deployment) observePendingRestart() {
+	id, since := d.meta.PendingRestart()
+	if id == "" || id == d.pendingRestartID {
+		return
+	}
 
-	return configInfoChanged
+	if since.IsZero() {
+		since = time.Now()
+	}
+	d.pendingRestartID = id
+	d.pendingRestartSince = since
 }
 
 // NeedsUpdate returns true if underlying k8s resource needs an update according to the
@@ -55,6 +151,59 @@ func (d *Deployment) NeedsUpdate() bool {
 	return false
 }
 
+// References returns true if the deployment references the given config
+func (d *Deployment) References(configName string) bool {
+	for _, name := range d.meta.ReferencedConfigs() {
+		if name == configName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HotReloads returns true if the deployment picks up changes of the given config
+// without a restart
+func (d *Deployment) HotReloads(configName string) bool {
+	for _, name := range d.meta.HotReloadedConfigs() {
+		if name == configName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ObserveChange remembers when a change to be applied to the deployment was first observed
+func (d *Deployment) ObserveChange(observedAt time.Time) {
+	if d.changeObservedAt.IsZero() || observedAt.Before(d.changeObservedAt) {
+		d.changeObservedAt = observedAt
+	}
+}
+
+// SpecChangeProcessed remembers when the processed change of the deployment itself was
+// last observed
+func (d *Deployment) SpecChangeProcessed(observedAt time.Time) {
+	d.specObservedAt = observedAt
+}
+
+// ChangesApplied forgets the observed changes once they are applied to the deployment.
+// Returns the time since the first of them was observed, false if there was none
+func (d *Deployment) ChangesApplied() (time.Duration, bool) {
+	if d.changeObservedAt.IsZero() {
+		return 0, false
+	}
+
+	latency := time.Since(d.changeObservedAt)
+	d.changeObservedAt = time.Time{}
+	return latency, true
+}
+
+// SinceRestart returns the time since the last restart of the deployment
+func (d *Deployment) SinceRestart() time.Duration {
+	return time.Since(d.restartedAt)
+}
+
 // SaveChecksums saves config checksums stored in the deployment instance as annotations
 // on the k8s resource, optionally triggering a restart
 func (d *Deployment) SaveChecksums(c interfaces.K8sClient, restart bool) error {
@@ -64,7 +213,121 @@ func (d *Deployment) SaveChecksums(c interfaces.K8sClient, restart bool) error {
 		glog.V(1).Infof("Deployment %s will be restarted", d.meta.FullName())
 	}
 
-	return d.meta.UpdateConfigChecksums(c, d.AppliedChecksums, restart)
+	err := d.meta.UpdateConfigChecksums(c, d.AppliedChecksums, restart)
+	if err == nil && restart {
+		d.restartedAt = time.Now()
+		d.restartedGeneration = d.meta.Generation()
+		d.rolloutReported = false
+	}
+
+	return err
+}
+
+// SaveRolloutStatus saves the state of the rollout triggered by the last restart as an
+// annotation and an event on the k8s resource. A final state is saved only once
+func (d *Deployment) SaveRolloutStatus(c interfaces.K8sClient, state RolloutState) error {
+	if state != RolloutProgressing {
+		d.rolloutReported = true
+	}
+
+	return d.meta.UpdateRolloutStatus(c, string(state), d.RestartedConfigs)
+}
+
+// RolloutState describes the progress of the rollout triggered by the last restart
+type RolloutState string
+
+const (
+	// RolloutNone means the deployment was not restarted by the controller
+	RolloutNone RolloutState = ""
+	// RolloutProgressing means the rollout is still in progress
+	RolloutProgressing RolloutState = "progressing"
+	// RolloutComplete means all replicas have been updated and are available
+	RolloutComplete RolloutState = "complete"
+	// RolloutFailed means the rollout exceeded its progress deadline
+	RolloutFailed RolloutState = "failed"
+	// RolloutTimedOut means the rollout did not complete within the timeout
+	RolloutTimedOut RolloutState = "timed-out"
+)
+
+// RolloutState returns the state of the rollout triggered by the last restart
+func (d *Deployment) RolloutState(timeout time.Duration) RolloutState {
+	if d.restartedAt.IsZero() {
+		return RolloutNone
+	}
+
+	// Restart bumps the generation. Until the bumped generation is observed, rollout
+	// status belongs to the previous rollout
+	if d.meta.Generation() > d.restartedGeneration {
+		switch {
+		case d.meta.RolloutComplete():
+			return RolloutComplete
+		case d.meta.RolloutFailed():
+			return RolloutFailed
+		}
+	}
+
+	if time.Now().Sub(d.restartedAt) >= timeout {
+		return RolloutTimedOut
+	}
+
+	return RolloutProgressing
+}
+
+// RequestRestartApproval saves the ID of a restart waiting for approval on the k8s resource,
+// unless the same restart is already pending. Returns the time since the restart is pending
+func (d *Deployment) RequestRestartApproval(c interfaces.K8sClient, id string, configs []string) (time.Time, error) {
+	if d.pendingRestartID == id {
+		return d.pendingRestartSince, nil
+	}
+
+	err := d.meta.UpdatePendingRestart(c, id, configs)
+	if err == nil {
+		d.pendingRestartID = id
+		d.pendingRestartSince = time.Now()
+	}
+	return d.pendingRestartSince, err
+}
+
+// ClearPendingRestart removes the ID of the restart waiting for approval and its approval
+// from the k8s resource, if any of them is known or present on the resource
+func (d *Deployment) ClearPendingRestart(c interfaces.K8sClient) error {
+	pendingID, _ := d.meta.PendingRestart()
+	if d.pendingRestartID == "" && pendingID == "" && d.meta.ApprovedRestart() == "" {
+		return nil
+	}
+
+	err := d.meta.UpdatePendingRestart(c, "", nil)
+	if err == nil {
+		d.pendingRestartID = ""
+		d.pendingRestartSince = time.Time{}
+	}
+	return err
+}
+
+// UnreportedRolloutState returns the state of the rollout triggered by the last restart,
+// unless its final state has already been saved
+func (d *Deployment) UnreportedRolloutState(timeout time.Duration) (RolloutState, bool) {
+	if d.restartedAt.IsZero() || d.rolloutReported {
+		return RolloutNone, false
+	}
+
+	return d.RolloutState(timeout), true
+}
+
+// RestartInProgress returns true if the deployment was restarted by the controller less
+// than timeout ago and the rollout has neither completed nor failed yet
+func (d *Deployment) RestartInProgress(timeout time.Duration) bool {
+	return d.RolloutState(timeout) == RolloutProgressing
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
 }
 
 func stringSlicesEqual(a, b []string) bool {
@@ -3,6 +3,7 @@ package controller
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/test"
 )
@@ -116,6 +117,40 @@ func TestDeploymentNeedsUpdateReturnsTrueWhenThereIsAnOrphanedChecksum(t *testin
 	equals(t, d.NeedsUpdate(), true)
 }
 
+func TestDeploymentUpdateFromMetaTracksTemplateChanges(t *testing.T) {
+	meta1 := test.NewDummyMetaDeployment()
+	meta1.TemplateChecksumValue = "abc"
+
+	d := NewDeployment(meta1)
+	before := time.Now()
+	equals(t, d.TemplateChangedAfter(time.Time{}), false)
+
+	d.UpdateFromMeta(meta1)
+	equals(t, d.TemplateChangedAfter(time.Time{}), false)
+
+	meta2 := test.NewDummyMetaDeployment()
+	meta2.TemplateChecksumValue = "bcd"
+	d.UpdateFromMeta(meta2)
+	equals(t, d.TemplateChangedAfter(before), true)
+	equals(t, d.TemplateChangedAfter(time.Now()), false)
+}
+
+func TestDeploymentChangesAppliedReturnsTimeSinceFirstObservedChange(t *testing.T) {
+	d := NewDeployment(test.NewDummyMetaDeployment())
+
+	_, ok := d.ChangesApplied()
+	equals(t, ok, false)
+
+	d.ObserveChange(time.Now().Add(-time.Minute))
+	d.ObserveChange(time.Now())
+	latency, ok := d.ChangesApplied()
+	equals(t, ok, true)
+	equals(t, latency >= time.Minute, true)
+
+	_, ok = d.ChangesApplied()
+	equals(t, ok, false)
+}
+
 func TestDeploymentNeedsUpdateReturnsTrueWhenChecksumDoesNotMatch(t *testing.T) {
 	metaD := test.NewDummyMetaDeployment()
 	metaD.AppliedChecksumsValue = map[string]string{"config": "checksum"}
@@ -128,6 +163,16 @@ func TestDeploymentNeedsUpdateReturnsTrueWhenChecksumDoesNotMatch(t *testing.T)
 	equals(t, d.NeedsUpdate(), true)
 }
 
+func TestDeploymentHotReloadsReturnsTrueOnlyForHotReloadedConfigs(t *testing.T) {
+	meta := test.NewDummyMetaDeployment()
+	meta.HotReloadedConfigsValue = []string{"config1"}
+
+	d := NewDeployment(meta)
+
+	equals(t, d.HotReloads("config1"), true)
+	equals(t, d.HotReloads("config2"), false)
+}
+
 func TestDeploymentSaveChecksumsCallsMetaUpdateConfigChecksums(t *testing.T) {
 	meta := test.NewDummyMetaDeployment()
 	meta.AppliedChecksumsValue = map[string]string{"config": "checksum"}
@@ -150,3 +195,69 @@ func TestDeploymentSaveChecksumsForwardsTheError(t *testing.T) {
 
 	equals(t, e, err)
 }
+
+func TestDeploymentRestartInProgressReturnsFalseWhenNotRestarted(t *testing.T) {
+	d := NewDeployment(test.NewDummyMetaDeployment())
+
+	equals(t, d.RestartInProgress(time.Minute), false)
+}
+
+func TestDeploymentRestartInProgressReturnsTrueUntilRolloutOfRestartCompletes(t *testing.T) {
+	meta := test.NewDummyMetaDeployment()
+	meta.GenerationValue = 1
+	meta.RolloutCompleteValue = true
+
+	d := NewDeployment(meta)
+	d.SaveChecksums(nil, true)
+	equals(t, d.RestartInProgress(time.Minute), true)
+
+	meta.GenerationValue = 2
+	meta.RolloutCompleteValue = false
+	equals(t, d.RestartInProgress(time.Minute), true)
+
+	meta.RolloutCompleteValue = true
+	equals(t, d.RestartInProgress(time.Minute), false)
+}
+
+func TestDeploymentRestartInProgressReturnsFalseWhenRolloutFailed(t *testing.T) {
+	meta := test.NewDummyMetaDeployment()
+
+	d := NewDeployment(meta)
+	d.SaveChecksums(nil, true)
+	meta.GenerationValue = 1
+	meta.RolloutFailedValue = true
+
+	equals(t, d.RestartInProgress(time.Minute), false)
+}
+
+func TestDeploymentRestartInProgressReturnsFalseAfterTimeout(t *testing.T) {
+	d := NewDeployment(test.NewDummyMetaDeployment())
+	d.SaveChecksums(nil, true)
+
+	equals(t, d.RestartInProgress(0), false)
+}
+
+func TestDeploymentUnreportedRolloutStateIsReturnedUntilFinalStateIsSaved(t *testing.T) {
+	meta := test.NewDummyMetaDeployment()
+	d := NewDeployment(meta)
+
+	_, ok := d.UnreportedRolloutState(time.Minute)
+	equals(t, ok, false)
+
+	d.RestartedConfigs = []string{"config"}
+	d.SaveChecksums(nil, true)
+	d.SaveRolloutStatus(nil, RolloutProgressing)
+	state, ok := d.UnreportedRolloutState(time.Minute)
+	equals(t, state, RolloutProgressing)
+	equals(t, ok, true)
+
+	meta.GenerationValue = 1
+	meta.RolloutCompleteValue = true
+	state, _ = d.UnreportedRolloutState(time.Minute)
+	d.SaveRolloutStatus(nil, state)
+
+	equals(t, meta.UpdatedRolloutState, "complete")
+	equals(t, meta.UpdatedRolloutConfigs, []string{"config"})
+	_, ok = d.UnreportedRolloutState(time.Minute)
+	equals(t, ok, false)
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const eventSourceComponent = "deployment-restart-controller"
+
+// configKinds maps config types to the kinds of k8s objects
+var configKinds = map[string]string{
+	configTypeConfigMap: "ConfigMap",
+	configTypeSecret:    "Secret",
+}
+
+// NewConfigEvent returns an event involving the config with the given full name
+func NewConfigEvent(fullName, eventType, reason, message string) *v1.Event {
+	parts := strings.SplitN(fullName, "/", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+
+	return newEvent(v1.ObjectReference{
+		APIVersion: v1.SchemeGroupVersion.String(),
+		Kind:       configKinds[parts[0]],
+		Namespace:  parts[1],
+		Name:       parts[2],
+	}, eventType, reason, message)
+}
+
+func newEvent(object v1.ObjectReference, eventType, reason, message string) *v1.Event {
+	now := metav1.NewTime(time.Now())
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: object.Name + ".",
+			Namespace:    object.Namespace,
+		},
+		InvolvedObject: object,
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Source:         v1.EventSource{Component: eventSourceComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+}
@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"testing"
+)
+
+func TestNewConfigEventInvolvesTheConfig(t *testing.T) {
+	event := NewConfigEvent("secret/test-namespace/test-name", "Warning", "Reason", "Message")
+
+	equals(t, event.Namespace, "test-namespace")
+	equals(t, event.InvolvedObject.Kind, "Secret")
+	equals(t, event.InvolvedObject.Name, "test-name")
+	equals(t, event.Type, "Warning")
+	equals(t, event.Reason, "Reason")
+	equals(t, event.Message, "Message")
+}
+
+func TestNewConfigEventReturnsNilForInvalidNames(t *testing.T) {
+	equals(t, NewConfigEvent("test-name", "Warning", "Reason", "Message") == nil, true)
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Graph is the dependency graph of configs and the deployments referencing them
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a config or a deployment identified by its full name. Configs that are
+// referenced but do not exist are pending
+type GraphNode struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	Pending bool   `json:"pending,omitempty"`
+}
+
+// GraphEdge links a config to a deployment referencing it. Changes of hot reloaded configs
+// do not restart the deployment
+type GraphEdge struct {
+	Config      string `json:"config"`
+	Workload    string `json:"workload"`
+	HotReloaded bool   `json:"hotReloaded,omitempty"`
+}
+
+// GraphFilter restricts a graph to the deployments referencing a config, or to the configs
+// referenced by a deployment, given by full names. Empty fields match everything
+type GraphFilter struct {
+	Config   string
+	Workload string
+}
+
+// NewGraph builds the dependency graph of the configs and deployments in the snapshot
+func NewGraph(snapshot interfaces.Snapshot, filter GraphFilter) Graph {
+	graph := Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	nodes := make(map[string]GraphNode)
+
+	for configName, config := range snapshot.Configs {
+		if filter.Config != "" && configName != filter.Config {
+			continue
+		}
+
+		linked := false
+		for _, deploymentName := range config.Deployments {
+			if filter.Workload != "" && deploymentName != filter.Workload {
+				continue
+			}
+			linked = true
+
+			deployment := snapshot.Deployments[deploymentName]
+			graph.Edges = append(graph.Edges, GraphEdge{
+				Config:      configName,
+				Workload:    deploymentName,
+				HotReloaded: containsString(deployment.HotReloaded, configName),
+			})
+			nodes[deploymentName] = GraphNode{ID: deploymentName, Kind: resourceType(deploymentName)}
+		}
+
+		if linked || filter.Workload == "" {
+			nodes[configName] = GraphNode{ID: configName, Kind: resourceType(configName), Pending: config.Pending}
+		}
+	}
+
+	if filter.Config == "" {
+		for deploymentName := range snapshot.Deployments {
+			if filter.Workload == "" || deploymentName == filter.Workload {
+				nodes[deploymentName] = GraphNode{ID: deploymentName, Kind: resourceType(deploymentName)}
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Config == graph.Edges[j].Config {
+			return graph.Edges[i].Workload < graph.Edges[j].Workload
+		}
+		return graph.Edges[i].Config < graph.Edges[j].Config
+	})
+
+	return graph
+}
+
+// LoadGraph lists the configs and deployments of the cluster once and builds their
+// dependency graph
+func LoadGraph(k8sClient kubernetes.Interface, settings Settings, filter GraphFilter) (Graph, error) {
+	agent, err := loadCatalog(k8sClient, settings)
+	if err != nil {
+		return Graph{}, err
+	}
+
+	return NewGraph(agent.snapshot(interfaces.SnapshotFilter{Workload: filter.Workload}), filter), nil
+}
+
+// DOT renders the graph in the Graphviz DOT language. Configs are drawn as notes, dashed
+// when pending, and edges of hot reloaded configs are dashed
+func (g Graph) DOT() string {
+	var b strings.Builder
+
+	b.WriteString("digraph dependencies {\n")
+	b.WriteString("  rankdir=LR;\n")
+
+	for _, node := range g.Nodes {
+		attributes := "shape=box"
+		if node.Kind == configTypeConfigMap || node.Kind == configTypeSecret {
+			attributes = "shape=note"
+			if node.Pending {
+				attributes += ", style=dashed"
+			}
+		}
+		fmt.Fprintf(&b, "  %q [%s];\n", node.ID, attributes)
+	}
+
+	for _, edge := range g.Edges {
+		attributes := ""
+		if edge.HotReloaded {
+			attributes = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "  %q -> %q%s;\n", edge.Config, edge.Workload, attributes)
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
+)
+
+func TestNewGraphLinksConfigsToDeployments(t *testing.T) {
+	graph := NewGraph(graphSnapshot(), GraphFilter{})
+
+	equals(t, graph.Nodes, []GraphNode{
+		{ID: "configmap/test/one", Kind: "configmap"},
+		{ID: "deployment/test/a", Kind: "deployment"},
+		{ID: "deployment/test/b", Kind: "deployment"},
+		{ID: "secret/test/two", Kind: "secret", Pending: true},
+	})
+	equals(t, graph.Edges, []GraphEdge{
+		{Config: "configmap/test/one", Workload: "deployment/test/a"},
+		{Config: "configmap/test/one", Workload: "deployment/test/b", HotReloaded: true},
+		{Config: "secret/test/two", Workload: "deployment/test/a"},
+	})
+}
+
+func TestNewGraphIsFilteredByConfig(t *testing.T) {
+	graph := NewGraph(graphSnapshot(), GraphFilter{Config: "configmap/test/one"})
+
+	equals(t, len(graph.Nodes), 3)
+	equals(t, len(graph.Edges), 2)
+}
+
+func TestNewGraphIsFilteredByWorkload(t *testing.T) {
+	graph := NewGraph(graphSnapshot(), GraphFilter{Workload: "deployment/test/b"})
+
+	equals(t, graph.Nodes, []GraphNode{
+		{ID: "configmap/test/one", Kind: "configmap"},
+		{ID: "deployment/test/b", Kind: "deployment"},
+	})
+	equals(t, len(graph.Edges), 1)
+}
+
+func TestGraphDOT(t *testing.T) {
+	graph := NewGraph(graphSnapshot(), GraphFilter{Workload: "deployment/test/b"})
+
+	equals(t, graph.DOT(), `digraph dependencies {
+  rankdir=LR;
+  "configmap/test/one" [shape=note];
+  "deployment/test/b" [shape=box];
+  "configmap/test/one" -> "deployment/test/b" [style=dashed];
+}
+`)
+}
+
+func graphSnapshot() interfaces.Snapshot {
+	return interfaces.Snapshot{
+		Configs: map[string]interfaces.ConfigSnapshot{
+			"configmap/test/one": {Checksum: "abc", Deployments: []string{"deployment/test/a", "deployment/test/b"}},
+			"secret/test/two":    {Pending: true, Deployments: []string{"deployment/test/a"}},
+		},
+		Deployments: map[string]interfaces.DeploymentSnapshot{
+			"deployment/test/a": {Namespace: "test"},
+			"deployment/test/b": {Namespace: "test", HotReloaded: []string{"configmap/test/one"}},
+		},
+	}
+}
@@ -1,9 +1,13 @@
 package interfaces
 
+import "time"
+
 // ConfigAgent contains the actual implementation of controller logic
 type ConfigAgent interface {
 	ResourceUpdated(MetaResource)
 	ResourceDeleted(MetaResource)
 	Start(chan struct{})
 	Stop()
+	LastActivity() time.Time
+	Snapshot(SnapshotFilter) (Snapshot, error)
 }
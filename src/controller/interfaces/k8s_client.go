@@ -1,8 +1,15 @@
 package interfaces
 
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
 // K8sClient is a wrapper around update functions for kubernetes to be exchangeable for
 // tests
 type K8sClient interface {
 	PatchDeployment(namespace, name string, data interface{}) error
 	PatchStatefulSet(namespace, name string, data interface{}) error
+	PatchConfigMap(namespace, name string, data interface{}) error
+	PatchSecret(namespace, name string, data interface{}) error
+	CreateEvent(event *v1.Event) error
 }
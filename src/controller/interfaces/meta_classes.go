@@ -1,5 +1,11 @@
 package interfaces
 
+import (
+	"time"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/util"
+)
+
 // MetaResource is a Kubernetes object that has meta data and is identifiable by some name
 type MetaResource interface {
 	FullName() string
@@ -9,14 +15,40 @@ type MetaResource interface {
 // MetaDeployment unifies "deployment" object types, i.e. Deployment and StatefulSet
 type MetaDeployment interface {
 	MetaResource
+	Namespace() string
+	Labels() map[string]string
+	ControllerClass() string
+	Generation() int64
+	TemplateChecksum() string
+	RolloutComplete() bool
+	RolloutFailed() bool
+	RolloutPaused() bool
+	ScaledToZero() bool
 	NeedsRestartOnConfigChange() bool
 	ReferencedConfigs() []string
+	HotReloadedConfigs() []string
+	GracePeriod() (time.Duration, bool)
+	MaxGracePeriod() (time.Duration, bool)
+	RestartWave() string
+	RestartWindow() (*util.Schedule, error)
+	ApprovalRequired() bool
+	ApprovalTimeout() (time.Duration, bool)
+	ApprovedRestart() string
+	PendingRestart() (string, time.Time)
+	ForceRestartTrigger() string
 	AppliedChecksums() map[string]string
 	UpdateConfigChecksums(k8sClient K8sClient, checksums map[string]string, restart bool) error
+	UpdateRolloutStatus(k8sClient K8sClient, state string, configs []string) error
+	UpdatePendingRestart(k8sClient K8sClient, id string, configs []string) error
+	ClearForceRestartTrigger(k8sClient K8sClient) error
+	RecordEvent(k8sClient K8sClient, eventType, reason, message string) error
 }
 
 // MetaConfig unifies "config" object types, i.e. ConfigMap and Secret
 type MetaConfig interface {
 	MetaResource
 	Checksum() string
+	BreakerReset() string
+	ForceRestartTrigger() string
+	Data() map[string]string
 }
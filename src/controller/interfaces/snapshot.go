@@ -0,0 +1,47 @@
+package interfaces
+
+// Snapshot is a copy of the catalog and the change queue of a config agent
+type Snapshot struct {
+	Configs     map[string]ConfigSnapshot     `json:"configs"`
+	Deployments map[string]DeploymentSnapshot `json:"deployments"`
+	Changes     []ChangeSnapshot              `json:"changes"`
+}
+
+// ConfigSnapshot describes a tracked config and the deployments referencing it
+type ConfigSnapshot struct {
+	Checksum      string   `json:"checksum,omitempty"`
+	Pending       bool     `json:"pending"`
+	ForcedRestart bool     `json:"forcedRestart,omitempty"`
+	Deployments   []string `json:"deployments"`
+}
+
+// DeploymentSnapshot describes a tracked deployment, the configs it references and the
+// checksums applied to it
+type DeploymentSnapshot struct {
+	Namespace        string            `json:"namespace"`
+	Configs          []string          `json:"configs"`
+	AppliedChecksums map[string]string `json:"appliedChecksums"`
+	Tombstones       map[string]string `json:"tombstones,omitempty"`
+	HotReloaded      []string          `json:"hotReloadedConfigs,omitempty"`
+	NeedsUpdate      bool              `json:"needsUpdate"`
+	ForcedRestart    bool              `json:"forcedRestart,omitempty"`
+	RestartedConfigs []string          `json:"restartedConfigs,omitempty"`
+	PendingRestartID string            `json:"pendingRestartID,omitempty"`
+}
+
+// ChangeSnapshot describes a change waiting in the queue. Ages are in seconds
+type ChangeSnapshot struct {
+	Resource     string  `json:"resource"`
+	Age          float64 `json:"age"`
+	Idle         float64 `json:"idle"`
+	Observations int     `json:"observations"`
+	Restart      bool    `json:"restart,omitempty"`
+	HoldReason   string  `json:"holdReason,omitempty"`
+}
+
+// SnapshotFilter restricts a snapshot to the deployments in a namespace or to a single
+// deployment given by full name, along with their configs. Empty fields match everything
+type SnapshotFilter struct {
+	Namespace string
+	Workload  string
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
 	v1 "k8s.io/api/core/v1"
@@ -16,33 +17,72 @@ const (
 )
 
 type metaConfig struct {
-	meta    metav1.ObjectMeta
-	typ     string
-	dataSha string
+	meta        metav1.ObjectMeta
+	typ         string
+	dataSha     string
+	data        map[string]string
+	annotations Annotations
 }
 
 func (c *metaConfig) FullName() string { return FullName(c.typ, c.meta.Namespace, c.meta.Name) }
 func (c *metaConfig) Version() string  { return c.meta.ResourceVersion }
 func (c *metaConfig) Checksum() string { return c.dataSha }
 
-// MetaConfigFromConfigMap converts a ConfigMap into MetaConfig
-func MetaConfigFromConfigMap(cm *v1.ConfigMap) interfaces.MetaConfig {
+// ForceRestartTrigger returns the value of the annotation requesting a restart of all
+// consumers of the config, if any
+func (c *metaConfig) ForceRestartTrigger() string {
+	value, _ := c.annotations.value(c.meta.Annotations, c.annotations.forceRestart)
+	return value
+}
+
+// Data returns the data of a ConfigMap. Data of secrets is not exposed
+func (c *metaConfig) Data() map[string]string { return c.data }
+
+// BreakerReset returns the config checksum whose open circuit breaker should be reset
+func (c *metaConfig) BreakerReset() string {
+	value, _ := c.annotations.value(c.meta.Annotations, c.annotations.breakerReset)
+	return value
+}
+
+// MetaConfigFromConfigMap converts a ConfigMap into MetaConfig, reading the given annotations
+func MetaConfigFromConfigMap(cm *v1.ConfigMap, annotations Annotations) interfaces.MetaConfig {
 	return &metaConfig{
-		meta:    cm.ObjectMeta,
-		typ:     configTypeConfigMap,
-		dataSha: getSha(cm.Data),
+		meta:        cm.ObjectMeta,
+		typ:         configTypeConfigMap,
+		dataSha:     getSha(cm.Data),
+		data:        cm.Data,
+		annotations: annotations,
 	}
 }
 
-// MetaConfigFromSecret converts a Secret into MetaConfig
-func MetaConfigFromSecret(s *v1.Secret) interfaces.MetaConfig {
+// MetaConfigFromSecret converts a Secret into MetaConfig, reading the given annotations
+func MetaConfigFromSecret(s *v1.Secret, annotations Annotations) interfaces.MetaConfig {
 	return &metaConfig{
-		meta:    s.ObjectMeta,
-		typ:     configTypeSecret,
-		dataSha: getSha(s.Data),
+		meta:        s.ObjectMeta,
+		typ:         configTypeSecret,
+		dataSha:     getSha(s.Data),
+		annotations: annotations,
 	}
 }
 
+// ClearConfigForceRestartTrigger removes the annotation requesting a restart of all
+// consumers from the config with the given full name
+func ClearConfigForceRestartTrigger(c interfaces.K8sClient, fullName string, annotations Annotations) error {
+	parts := strings.SplitN(fullName, "/", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("Invalid config name %s", fullName)
+	}
+
+	switch parts[0] {
+	case configTypeConfigMap:
+		return c.PatchConfigMap(parts[1], parts[2], annotations.forceRestartClearPatch())
+	case configTypeSecret:
+		return c.PatchSecret(parts[1], parts[2], annotations.forceRestartClearPatch())
+	}
+
+	return fmt.Errorf("Unknown config type %s", parts[0])
+}
+
 // FullName builds a full name to identify a MetaResource
 func FullName(typ, namespace, name string) string {
 	return fmt.Sprintf("%s/%s/%s", typ, namespace, name)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/test"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -15,7 +16,7 @@ func TestMetaConfigFromConfigMapReturnsValidMetaConfig(t *testing.T) {
 	data := map[string]string{"key": "value"}
 	c := newConfigMap(namespace, name, version, data)
 
-	mc := MetaConfigFromConfigMap(c)
+	mc := MetaConfigFromConfigMap(c, DefaultAnnotations())
 	expectedChecksum := "e43abcf337524483" // echo -n '{"key":"value"}' | shasum -a 256 | cut -c1-16
 
 	equals(t, mc.FullName(), fmt.Sprintf("configmap/%s/%s", namespace, name))
@@ -30,7 +31,7 @@ func TestMetaConfigFromSecretReturnsValidMetaConfig(t *testing.T) {
 	data := map[string][]byte{"key": []byte("value")}
 	s := newSecret(namespace, name, version, data)
 
-	mc := MetaConfigFromSecret(s)
+	mc := MetaConfigFromSecret(s, DefaultAnnotations())
 	expectedChecksum := "fed7a27106a07691" // echo -n "{\"key\":\"`echo -n "value" | base64`\"}" | shasum -a 256 | cut -c1-16
 
 	equals(t, mc.FullName(), fmt.Sprintf("secret/%s/%s", namespace, name))
@@ -38,6 +39,33 @@ func TestMetaConfigFromSecretReturnsValidMetaConfig(t *testing.T) {
 	equals(t, mc.Checksum(), expectedChecksum)
 }
 
+func TestMetaConfigBreakerResetIsReadFromAnnotation(t *testing.T) {
+	c := newConfigMap("test-namespace", "test-name", "1", nil)
+	equals(t, MetaConfigFromConfigMap(c, DefaultAnnotations()).BreakerReset(), "")
+
+	c.Annotations = map[string]string{"com.xing.deployment-restart.reset-breaker": "e43abcf337524483"}
+	equals(t, MetaConfigFromConfigMap(c, DefaultAnnotations()).BreakerReset(), "e43abcf337524483")
+}
+
+func TestMetaConfigForceRestartTriggerIsReadFromAnnotation(t *testing.T) {
+	s := newSecret("test-namespace", "test-name", "1", nil)
+	equals(t, MetaConfigFromSecret(s, DefaultAnnotations()).ForceRestartTrigger(), "")
+
+	s.Annotations = map[string]string{"com.xing.deployment-restart.force-restart": "now"}
+	equals(t, MetaConfigFromSecret(s, DefaultAnnotations()).ForceRestartTrigger(), "now")
+}
+
+func TestClearConfigForceRestartTriggerPatchesTheConfig(t *testing.T) {
+	c := test.NewDummyK8sClient()
+
+	equals(t, ClearConfigForceRestartTrigger(c, "secret/test-namespace/test-name", DefaultAnnotations()), nil)
+	equals(t, len(c.Patches), 1)
+	equals(t, c.Patches[0].Path, "secret/test-namespace/test-name")
+	equals(t, c.Patches[0].Data, DefaultAnnotations().forceRestartClearPatch())
+
+	equals(t, ClearConfigForceRestartTrigger(c, "invalid", DefaultAnnotations()) != nil, true)
+}
+
 func newConfigMap(namespace, name, version string, data map[string]string) *core.ConfigMap {
 	if data == nil {
 		data = map[string]string{}
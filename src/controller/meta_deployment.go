@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -12,59 +14,132 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
+	"github.com/xing/kubernetes-deployment-restart-controller/src/util"
 )
 
 const (
-	enabledAnnotation                  = "com.xing.deployment-restart"
-	configChecksumsAnnotation          = "com.xing.deployment-restart.applied-config-checksums"
-	deploymentRestartTriggerAnnotation = "com.xing.deployment-restart.timestamp"
-
 	deploymentTypeDeployment  = "deployment"
 	deploymentTypeStatefulSet = "statefulset"
 )
 
 type metaDeployment struct {
-	typ               string
-	meta              metav1.ObjectMeta
-	specTemplate      v1.PodTemplateSpec
-	referencedConfigs []string
-	configChecksums   map[string]string
+	typ                string
+	meta               metav1.ObjectMeta
+	specTemplate       v1.PodTemplateSpec
+	rollout            rolloutStatus
+	paused             bool
+	replicas           *int32
+	referencedConfigs  []string
+	hotReloadedConfigs []string
+	configChecksums    map[string]string
+	restartWindow      *util.Schedule
+	restartWindowErr   error
+	restartWindowRead  bool
+	templateChecksum   string
+	annotations        Annotations
 }
 
-// MetaDeploymentFromDeployment instantiates a meta deployment from a k8s Deployment
-func MetaDeploymentFromDeployment(deployment *appsv1.Deployment) interfaces.MetaDeployment {
+// MetaDeploymentFromDeployment instantiates a meta deployment from a k8s Deployment, reading
+// and writing the given annotations
+func MetaDeploymentFromDeployment(deployment *appsv1.Deployment, annotations Annotations) interfaces.MetaDeployment {
 	return &metaDeployment{
 		typ:          deploymentTypeDeployment,
 		meta:         deployment.ObjectMeta,
 		specTemplate: deployment.Spec.Template,
+		rollout:      deploymentRolloutStatus(deployment),
+		paused:       deployment.Spec.Paused,
+		replicas:     deployment.Spec.Replicas,
+		annotations:  annotations,
 	}
 }
 
-// MetaDeploymentFromStatefulSet instantiates a meta deployment from a k8s StatefulSet
-func MetaDeploymentFromStatefulSet(statefulSet *appsv1.StatefulSet) interfaces.MetaDeployment {
+// MetaDeploymentFromStatefulSet instantiates a meta deployment from a k8s StatefulSet,
+// reading and writing the given annotations
+func MetaDeploymentFromStatefulSet(statefulSet *appsv1.StatefulSet, annotations Annotations) interfaces.MetaDeployment {
 	return &metaDeployment{
 		typ:          deploymentTypeStatefulSet,
 		meta:         statefulSet.ObjectMeta,
 		specTemplate: statefulSet.Spec.Template,
+		rollout:      statefulSetRolloutStatus(statefulSet),
+		replicas:     statefulSet.Spec.Replicas,
+		annotations:  annotations,
 	}
 }
 
-func (d *metaDeployment) Version() string  { return d.meta.ResourceVersion }
-func (d *metaDeployment) FullName() string { return FullName(d.typ, d.meta.Namespace, d.meta.Name) }
+func (d *metaDeployment) Version() string           { return d.meta.ResourceVersion }
+func (d *metaDeployment) FullName() string          { return FullName(d.typ, d.meta.Namespace, d.meta.Name) }
+func (d *metaDeployment) Namespace() string         { return d.meta.Namespace }
+func (d *metaDeployment) Labels() map[string]string { return d.meta.Labels }
+func (d *metaDeployment) Generation() int64         { return d.meta.Generation }
+func (d *metaDeployment) RolloutComplete() bool     { return d.rollout.complete }
+func (d *metaDeployment) RolloutFailed() bool       { return d.rollout.failed }
+func (d *metaDeployment) RolloutPaused() bool       { return d.paused }
+
+// ScaledToZero returns true if the deployment is explicitly scaled to zero replicas
+func (d *metaDeployment) ScaledToZero() bool {
+	return d.replicas != nil && *d.replicas == 0
+}
+
+// TemplateChecksum returns a checksum of the pod template. The template annotation set by
+// the controller to restart the deployment is left out, so that only changes made by others
+// change the checksum
+func (d *metaDeployment) TemplateChecksum() string {
+	if d.templateChecksum == "" {
+		template := d.specTemplate.DeepCopy()
+		delete(template.Annotations, d.annotations.deploymentRestartTrigger)
+		if legacyKey := d.annotations.legacy(d.annotations.deploymentRestartTrigger); legacyKey != "" {
+			delete(template.Annotations, legacyKey)
+		}
+		d.templateChecksum = getSha(template)
+	}
+	return d.templateChecksum
+}
 
 // ReferencedConfigs returns a list of full names of all config-like objects referenced in
-// the deployment pod spec
+// the deployment pod spec or listed in the extra configs or Reloader annotations. Like
+// Reloader, deployments enabled only by Reloader name lists reference the listed configs
+// but not those of the pod spec, and deployments with Reloader auto reference every config
+// of the pod spec
 func (d *metaDeployment) ReferencedConfigs() []string {
 	if d.referencedConfigs == nil {
-		d.referencedConfigs = configNamesFromTemplate(d.specTemplate, d.meta)
+		var configs []string
+		listed := d.annotations.reloaderConfigNames(d.meta)
+		switch {
+		case d.annotations.reloaderAuto(d.meta):
+			configs = allConfigNamesFromTemplate(d.specTemplate, d.meta)
+		case d.enabled() || len(listed) == 0:
+			configs = configNamesFromTemplate(d.specTemplate, d.meta)
+		}
+		configs = append(configs, d.extraConfigNames()...)
+		for _, name := range listed {
+			if !containsString(configs, name) {
+				configs = append(configs, name)
+			}
+		}
+		sort.Strings(configs)
+		d.referencedConfigs = configs
 	}
 	return d.referencedConfigs
 }
 
+// HotReloadedConfigs returns a list of full names of configs that are consumed only
+// through volumes without subPath. Kubelet updates such volumes in place, so the
+// deployment does not need a restart when they change. The list is empty unless the
+// deployment opted in via annotation
+func (d *metaDeployment) HotReloadedConfigs() []string {
+	if d.hotReloadedConfigs == nil {
+		d.hotReloadedConfigs = []string{}
+		if value, ok := d.annotations.value(d.meta.Annotations, d.annotations.hotReloadVolumes); ok && value == "enabled" {
+			d.hotReloadedConfigs = hotReloadedConfigNamesFromTemplate(d.specTemplate, d.meta)
+		}
+	}
+	return d.hotReloadedConfigs
+}
+
 // AppliedChecksums returns parsed config checksum annotation value
 func (d *metaDeployment) AppliedChecksums() map[string]string {
 	if d.configChecksums == nil {
-		d.configChecksums = configChecksumsFromMeta(d.meta)
+		d.configChecksums = d.configChecksumsFromMeta()
 	}
 	return d.configChecksums
 }
@@ -72,10 +147,151 @@ func (d *metaDeployment) AppliedChecksums() map[string]string {
 // NeedsRestartOnConfigChange returns true if the deployment is configured to be restarted
 // when any of its configuration resources is changed
 func (d *metaDeployment) NeedsRestartOnConfigChange() bool {
-	value, ok := d.meta.Annotations[enabledAnnotation]
+	return d.enabled() || d.annotations.reloaderAuto(d.meta) || len(d.annotations.reloaderConfigNames(d.meta)) > 0
+}
+
+// enabled returns true if the deployment is enabled by the controller's own annotation
+func (d *metaDeployment) enabled() bool {
+	value, ok := d.annotations.value(d.meta.Annotations, d.annotations.enabled)
 	return ok && value == "enabled"
 }
 
+// GracePeriod returns the grace period of changes affecting the deployment, and whether the
+// deployment overrides it
+func (d *metaDeployment) GracePeriod() (time.Duration, bool) {
+	return d.durationFromMeta(d.annotations.gracePeriod)
+}
+
+// MaxGracePeriod returns the maximum grace period of debounced changes affecting the
+// deployment, and whether the deployment overrides it
+func (d *metaDeployment) MaxGracePeriod() (time.Duration, bool) {
+	return d.durationFromMeta(d.annotations.maxGracePeriod)
+}
+
+// RestartWave returns the restart wave the deployment is assigned to by annotation or by
+// label, if any. The annotation takes precedence
+func (d *metaDeployment) RestartWave() string {
+	if value, ok := d.annotations.value(d.meta.Annotations, d.annotations.restartWave); ok {
+		return value
+	}
+	value, _ := d.annotations.value(d.meta.Labels, d.annotations.restartWave)
+	return value
+}
+
+// RestartWindow returns the schedule of times the deployment may be restarted at, or nil if
+// the deployment does not restrict them. Returns an error if the annotation is invalid
+func (d *metaDeployment) RestartWindow() (*util.Schedule, error) {
+	if d.restartWindowRead {
+		return d.restartWindow, d.restartWindowErr
+	}
+	d.restartWindowRead = true
+
+	value, ok := d.annotations.value(d.meta.Annotations, d.annotations.restartWindow)
+	if !ok {
+		return nil, nil
+	}
+
+	schedule, err := util.ParseSchedule(value)
+	if err != nil {
+		d.restartWindowErr = fmt.Errorf("invalid %s annotation: %s", d.annotations.restartWindow, err)
+		return nil, d.restartWindowErr
+	}
+
+	d.restartWindow = schedule
+	return schedule, nil
+}
+
+// ApprovalRequired returns true if restarts of the deployment need to be approved
+func (d *metaDeployment) ApprovalRequired() bool {
+	value, ok := d.annotations.value(d.meta.Annotations, d.annotations.approval)
+	return ok && value == "required"
+}
+
+// ApprovalTimeout returns the time after which a pending restart is approved automatically,
+// and whether the deployment overrides it
+func (d *metaDeployment) ApprovalTimeout() (time.Duration, bool) {
+	return d.durationFromMeta(d.annotations.approvalTimeout)
+}
+
+// ApprovedRestart returns the ID of the pending restart approved by an operator
+func (d *metaDeployment) ApprovedRestart() string {
+	value, _ := d.annotations.value(d.meta.Annotations, d.annotations.restartApproved)
+	return value
+}
+
+// PendingRestart returns the ID of the restart waiting for approval and the time since it
+// is pending, as saved on the underlying k8s object. The time is zero if it is missing or
+// can not be parsed
+func (d *metaDeployment) PendingRestart() (string, time.Time) {
+	encodedValue, ok := d.annotations.value(d.meta.Annotations, d.annotations.restartPending)
+	if !ok {
+		return "", time.Time{}
+	}
+
+	var value pendingRestartValue
+	if err := json.Unmarshal([]byte(encodedValue), &value); err != nil {
+		glog.Warningf("Failed to parse %s annotation of %s: %s", d.annotations.restartPending, d.FullName(), err)
+		return "", time.Time{}
+	}
+
+	since, err := time.Parse(time.RFC3339, value.Timestamp)
+	if err != nil {
+		return value.ID, time.Time{}
+	}
+	return value.ID, since
+}
+
+// UpdatePendingRestart patches the underlying k8s object with the ID of a restart waiting
+// for approval and the configs that caused it, and records an event. An empty ID removes
+// the pending restart and its approval
+func (d *metaDeployment) UpdatePendingRestart(c interfaces.K8sClient, id string, configs []string) error {
+	annotations := map[string]interface{}{
+		d.annotations.restartPending:  nil, // null removes the annotation
+		d.annotations.restartApproved: nil,
+	}
+	if id != "" {
+		encodedValue, _ := json.Marshal(pendingRestartValue{
+			ID:        id,
+			Configs:   configs,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		})
+		annotations = map[string]interface{}{d.annotations.restartPending: string(encodedValue)}
+	}
+
+	patchData := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	}
+
+	err := d.patch(c, patchData)
+	if err != nil || id == "" {
+		return err
+	}
+
+	message := fmt.Sprintf("Restart due to changes of %s is waiting for approval, set the %s annotation to %s to approve it", strings.Join(configs, ", "), d.annotations.restartApproved, id)
+	return c.CreateEvent(newEvent(d.objectReference(), v1.EventTypeNormal, "ConfigRestartPendingApproval", message))
+}
+
+// ForceRestartTrigger returns the value of the annotation requesting a restart, if any
+func (d *metaDeployment) ForceRestartTrigger() string {
+	value, _ := d.annotations.value(d.meta.Annotations, d.annotations.forceRestart)
+	return value
+}
+
+// ControllerClass returns the class of the controller instance responsible for the
+// deployment, empty if the deployment does not name one
+func (d *metaDeployment) ControllerClass() string {
+	value, _ := d.annotations.value(d.meta.Annotations, d.annotations.class)
+	return value
+}
+
+// ClearForceRestartTrigger removes the annotation requesting a restart from the underlying
+// k8s object
+func (d *metaDeployment) ClearForceRestartTrigger(c interfaces.K8sClient) error {
+	return d.patch(c, d.annotations.forceRestartClearPatch())
+}
+
 // UpdateConfigChecksums patches the underlying k8s object with given checksum annotations
 // and optionally triggers a restart by changing a template annotation
 func (d *metaDeployment) UpdateConfigChecksums(c interfaces.K8sClient, checksums map[string]string, restart bool) error {
@@ -83,9 +299,9 @@ func (d *metaDeployment) UpdateConfigChecksums(c interfaces.K8sClient, checksums
 
 	patchData := map[string]interface{}{
 		"metadata": map[string]interface{}{
-			"annotations": map[string]interface{}{
-				configChecksumsAnnotation: string(encodedChecksums),
-			},
+			"annotations": d.annotations.withLegacyRemoved(map[string]interface{}{
+				d.annotations.configChecksums: string(encodedChecksums),
+			}, d.annotations.configChecksums),
 		},
 	}
 
@@ -94,13 +310,93 @@ func (d *metaDeployment) UpdateConfigChecksums(c interfaces.K8sClient, checksums
 			"template": map[string]interface{}{
 				"metadata": map[string]interface{}{
 					"annotations": map[string]interface{}{
-						deploymentRestartTriggerAnnotation: time.Now().Format(time.Stamp),
+						d.annotations.deploymentRestartTrigger: time.Now().Format(time.Stamp),
 					},
 				},
 			},
 		}
 	}
 
+	return d.patch(c, patchData)
+}
+
+// rolloutStatusValue is the value of the rollout status annotation
+type rolloutStatusValue struct {
+	State     string   `json:"state"`
+	Configs   []string `json:"configs"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// pendingRestartValue is the value of the restart pending annotation
+type pendingRestartValue struct {
+	ID        string   `json:"id"`
+	Configs   []string `json:"configs"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// rolloutEvents maps rollout states to the events recorded for them
+var rolloutEvents = map[string]struct{ typ, reason, message string }{
+	"progressing": {v1.EventTypeNormal, "ConfigRestartTriggered", "Restarted due to %s"},
+	"complete":    {v1.EventTypeNormal, "ConfigRestartCompleted", "Rollout completed after restart due to %s"},
+	"failed":      {v1.EventTypeWarning, "ConfigRestartFailed", "Rollout failed after restart due to %s"},
+	"timed-out":   {v1.EventTypeWarning, "ConfigRestartTimedOut", "Rollout did not complete in time after restart due to %s"},
+}
+
+// restartCause describes what caused a restart for event messages
+func restartCause(configs []string) string {
+	if len(configs) == 0 {
+		return "a force restart request"
+	}
+
+	return "changes of " + strings.Join(configs, ", ")
+}
+
+// UpdateRolloutStatus patches the underlying k8s object with the state of the rollout
+// triggered by a restart and the configs that caused the restart, and records an event
+func (d *metaDeployment) UpdateRolloutStatus(c interfaces.K8sClient, state string, configs []string) error {
+	encodedStatus, _ := json.Marshal(rolloutStatusValue{
+		State:     state,
+		Configs:   configs,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+
+	patchData := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				d.annotations.rolloutStatus: string(encodedStatus),
+			},
+		},
+	}
+
+	if err := d.patch(c, patchData); err != nil {
+		return err
+	}
+
+	event, ok := rolloutEvents[state]
+	if !ok {
+		return nil
+	}
+
+	return c.CreateEvent(newEvent(d.objectReference(), event.typ, event.reason, fmt.Sprintf(event.message, restartCause(configs))))
+}
+
+// RecordEvent records an event involving the underlying k8s object
+func (d *metaDeployment) RecordEvent(c interfaces.K8sClient, eventType, reason, message string) error {
+	return c.CreateEvent(newEvent(d.objectReference(), eventType, reason, message))
+}
+
+// forceRestartClearPatch returns the patch removing the annotation requesting a restart
+func (a Annotations) forceRestartClearPatch() map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": a.withLegacyRemoved(map[string]interface{}{
+				a.forceRestart: nil, // null removes the annotation
+			}, a.forceRestart),
+		},
+	}
+}
+
+func (d *metaDeployment) patch(c interfaces.K8sClient, patchData map[string]interface{}) error {
 	switch d.typ {
 	case deploymentTypeDeployment:
 		return c.PatchDeployment(d.meta.Namespace, d.meta.Name, patchData)
@@ -111,6 +407,28 @@ func (d *metaDeployment) UpdateConfigChecksums(c interfaces.K8sClient, checksums
 	return fmt.Errorf("Unknown meta deployment type %s", d.typ)
 }
 
+// resourceType returns the type of the resource with the given full name, e.g. configmap
+// or statefulset
+func resourceType(fullName string) string {
+	return strings.SplitN(fullName, "/", 2)[0]
+}
+
+func (d *metaDeployment) objectReference() v1.ObjectReference {
+	kind := "Deployment"
+	if d.typ == deploymentTypeStatefulSet {
+		kind = "StatefulSet"
+	}
+
+	return v1.ObjectReference{
+		APIVersion:      appsv1.SchemeGroupVersion.String(),
+		Kind:            kind,
+		Namespace:       d.meta.Namespace,
+		Name:            d.meta.Name,
+		UID:             d.meta.UID,
+		ResourceVersion: d.meta.ResourceVersion,
+	}
+}
+
 func configNamesFromTemplate(templateSpec v1.PodTemplateSpec, meta metav1.ObjectMeta) []string {
 	var configs []string
 	namespace := meta.Namespace
@@ -139,8 +457,193 @@ func configNamesFromTemplate(templateSpec v1.PodTemplateSpec, meta metav1.Object
 	return configs
 }
 
-func configChecksumsFromMeta(meta metav1.ObjectMeta) map[string]string {
-	value, ok := meta.Annotations[configChecksumsAnnotation]
+// allConfigNamesFromTemplate returns the full names of all configs consumed by the pod
+// template: through envFrom and valueFrom of containers and init containers, and through
+// ConfigMap, Secret and projected volumes
+func allConfigNamesFromTemplate(templateSpec v1.PodTemplateSpec, meta metav1.ObjectMeta) []string {
+	var configs []string
+	namespace := meta.Namespace
+
+	for _, container := range podContainers(templateSpec) {
+		for _, configName := range envConfigNames(container, namespace) {
+			if !containsString(configs, configName) {
+				configs = append(configs, configName)
+			}
+		}
+	}
+
+	for _, volume := range templateSpec.Spec.Volumes {
+		for _, configName := range volumeConfigNames(volume, namespace) {
+			if !containsString(configs, configName) {
+				configs = append(configs, configName)
+			}
+		}
+	}
+
+	sort.Strings(configs)
+
+	return configs
+}
+
+// extraConfigNames parses a comma separated list of config references in the
+// form of type/name or type/namespace/name, e.g. "configmap/app-settings,
+// secret/kube-system/ca-bundle". References without a namespace point to the namespace
+// of the deployment
+func (d *metaDeployment) extraConfigNames() []string {
+	meta := d.meta
+	value, ok := d.annotations.value(meta.Annotations, d.annotations.extraConfigs)
+	if !ok {
+		return nil
+	}
+
+	var configs []string
+	for _, reference := range strings.Split(value, ",") {
+		reference = strings.TrimSpace(reference)
+		if reference == "" {
+			continue
+		}
+
+		parts := strings.Split(reference, "/")
+		typ, namespace, name := "", meta.Namespace, ""
+		switch len(parts) {
+		case 2:
+			typ, name = parts[0], parts[1]
+		case 3:
+			typ, namespace, name = parts[0], parts[1], parts[2]
+		}
+
+		if (typ != configTypeConfigMap && typ != configTypeSecret) || namespace == "" || name == "" {
+			glog.Warningf("Ignoring invalid extra config reference %q of %s/%s", reference, meta.Namespace, meta.Name)
+			continue
+		}
+
+		configs = append(configs, FullName(typ, namespace, name))
+	}
+
+	return configs
+}
+
+// hotReloadedConfigNamesFromTemplate returns the configs consumed only through volumes
+// mounted without subPath by any container. Configs of volumes not mounted at all, mounted
+// with subPath, or also consumed through environment variables need restarts
+func hotReloadedConfigNamesFromTemplate(templateSpec v1.PodTemplateSpec, meta metav1.ObjectMeta) []string {
+	namespace := meta.Namespace
+	restartRequired := make(map[string]struct{})
+	mounted := make(map[string]struct{})
+
+	volumeConfigs := make(map[string][]string)
+	for _, volume := range templateSpec.Spec.Volumes {
+		volumeConfigs[volume.Name] = volumeConfigNames(volume, namespace)
+	}
+
+	for _, container := range podContainers(templateSpec) {
+		for _, configName := range envConfigNames(container, namespace) {
+			restartRequired[configName] = struct{}{}
+		}
+
+		// Kubelet never updates files mounted with subPath
+		for _, mount := range container.VolumeMounts {
+			for _, configName := range volumeConfigs[mount.Name] {
+				if mount.SubPath != "" || mount.SubPathExpr != "" {
+					restartRequired[configName] = struct{}{}
+				} else {
+					mounted[configName] = struct{}{}
+				}
+			}
+		}
+	}
+
+	configs := []string{}
+	for configName := range mounted {
+		if _, ok := restartRequired[configName]; !ok {
+			configs = append(configs, configName)
+		}
+	}
+
+	sort.Strings(configs)
+
+	return configs
+}
+
+// podContainers returns the init containers and containers of a pod template
+func podContainers(templateSpec v1.PodTemplateSpec) []v1.Container {
+	return append(append([]v1.Container{}, templateSpec.Spec.InitContainers...), templateSpec.Spec.Containers...)
+}
+
+// volumeConfigNames returns the full names of the configs of a ConfigMap, Secret or
+// projected volume
+func volumeConfigNames(volume v1.Volume, namespace string) []string {
+	var configs []string
+	switch {
+	case volume.ConfigMap != nil:
+		configs = append(configs, FullName(configTypeConfigMap, namespace, volume.ConfigMap.Name))
+	case volume.Secret != nil:
+		configs = append(configs, FullName(configTypeSecret, namespace, volume.Secret.SecretName))
+	case volume.Projected != nil:
+		for _, source := range volume.Projected.Sources {
+			switch {
+			case source.ConfigMap != nil:
+				configs = append(configs, FullName(configTypeConfigMap, namespace, source.ConfigMap.Name))
+			case source.Secret != nil:
+				configs = append(configs, FullName(configTypeSecret, namespace, source.Secret.Name))
+			}
+		}
+	}
+	return configs
+}
+
+// envConfigNames returns the full names of the configs a container consumes through
+// environment variables, with envFrom or with valueFrom key references
+func envConfigNames(container v1.Container, namespace string) []string {
+	var configs []string
+	for _, envFromSource := range container.EnvFrom {
+		switch {
+		case envFromSource.ConfigMapRef != nil:
+			configs = append(configs, FullName(configTypeConfigMap, namespace, envFromSource.ConfigMapRef.Name))
+		case envFromSource.SecretRef != nil:
+			configs = append(configs, FullName(configTypeSecret, namespace, envFromSource.SecretRef.Name))
+		}
+	}
+	for _, env := range container.Env {
+		if env.ValueFrom == nil {
+			continue
+		}
+		switch {
+		case env.ValueFrom.ConfigMapKeyRef != nil:
+			configs = append(configs, FullName(configTypeConfigMap, namespace, env.ValueFrom.ConfigMapKeyRef.Name))
+		case env.ValueFrom.SecretKeyRef != nil:
+			configs = append(configs, FullName(configTypeSecret, namespace, env.ValueFrom.SecretKeyRef.Name))
+		}
+	}
+	return configs
+}
+
+// durationFromMeta parses an annotation value either as a duration, e.g. "1m30s", or as a
+// number of seconds. Returns false if the annotation is not set or invalid, so that zero
+// can be told apart from a missing annotation
+func (d *metaDeployment) durationFromMeta(annotation string) (time.Duration, bool) {
+	meta := d.meta
+	value, ok := d.annotations.value(meta.Annotations, annotation)
+	if !ok {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		glog.Warningf("Ignoring invalid %s annotation value %q of %s/%s", annotation, value, meta.Namespace, meta.Name)
+		return 0, false
+	}
+
+	return duration, true
+}
+
+func (d *metaDeployment) configChecksumsFromMeta() map[string]string {
+	meta := d.meta
+	value, ok := d.annotations.value(meta.Annotations, d.annotations.configChecksums)
 	if !ok {
 		glog.V(3).Infof("Config checksums annotation for %s/%s not found. Assuming an empty map", meta.Namespace, meta.Name)
 		return make(map[string]string)
@@ -31,7 +31,7 @@ spec:
         - configMapRef:
             name: config-one`)
 
-	md := MetaDeploymentFromDeployment(d)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
 
 	equals(t, md.FullName(), "deployment/test-namespace/test-name")
 	equals(t, md.Version(), "123456")
@@ -57,7 +57,7 @@ spec:
         - configMapRef:
             name: config-one`)
 
-	md := MetaDeploymentFromStatefulSet(s)
+	md := MetaDeploymentFromStatefulSet(s, DefaultAnnotations())
 
 	equals(t, md.FullName(), "statefulset/test-namespace/test-name")
 	equals(t, md.Version(), "123456")
@@ -75,7 +75,7 @@ metadata:
     com.xing.deployment-restart: enabled
 `)
 
-	md := MetaDeploymentFromDeployment(d)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
 	equals(t, md.NeedsRestartOnConfigChange(), true)
 }
 
@@ -87,7 +87,7 @@ metadata:
   namespace: test-namespace
 `)
 
-	md := MetaDeploymentFromDeployment(d)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
 	equals(t, md.NeedsRestartOnConfigChange(), false)
 }
 
@@ -102,7 +102,7 @@ metadata:
         {"config-one":"checksum-one","config-two":"checksum-two"}
 `)
 
-	md := MetaDeploymentFromDeployment(d)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
 	expected := map[string]string{
 		"config-one": "checksum-one",
 		"config-two": "checksum-two",
@@ -119,7 +119,7 @@ metadata:
   namespace: test-namespace
 `)
 
-	md := MetaDeploymentFromDeployment(d)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
 	expected := map[string]string{}
 
 	equals(t, md.AppliedChecksums(), expected)
@@ -136,7 +136,7 @@ metadata:
         NOT A JSON STRING
 `)
 
-	md := MetaDeploymentFromDeployment(d)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
 	expected := map[string]string{}
 
 	equals(t, md.AppliedChecksums(), expected)
@@ -166,7 +166,7 @@ spec:
           configMap:
             name: config-b`)
 
-	md := MetaDeploymentFromDeployment(d)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
 	expected := []string{
 		"configmap/test-namespace/config-a",
 		"configmap/test-namespace/config-b",
@@ -179,6 +179,395 @@ spec:
 	equals(t, md.ReferencedConfigs(), expected)
 }
 
+func TestMetaDeploymentReferencedConfigsIncludesExtraConfigsFromAnnotation(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  annotations:
+    com.xing.deployment-restart.extra-configs: "secret/kube-system/ca-bundle, configmap/config-b,invalid,volume/v"
+spec:
+  template:
+    spec:
+      containers:
+      - envFrom:
+        - configMapRef:
+            name: config-a`)
+
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+	expected := []string{
+		"configmap/test-namespace/config-a",
+		"configmap/test-namespace/config-b",
+		"secret/kube-system/ca-bundle",
+	}
+
+	equals(t, md.ReferencedConfigs(), expected)
+}
+
+func TestMetaDeploymentHotReloadedConfigsReturnsEmptyListWhenNotEnabled(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+spec:
+  template:
+    spec:
+      containers:
+      - volumeMounts:
+        - name: volumeOne
+          mountPath: /config
+      volumes:
+        - name: volumeOne
+          configMap:
+            name: config-a`)
+
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+
+	equals(t, md.HotReloadedConfigs(), []string{})
+}
+
+func TestMetaDeploymentHotReloadedConfigsCollectsConfigsMountedOnlyWithoutSubPath(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  annotations:
+    com.xing.deployment-restart.hot-reload-volumes: enabled
+spec:
+  template:
+    spec:
+      containers:
+      - envFrom:
+        - configMapRef:
+            name: config-c
+        volumeMounts:
+        - name: volumeA
+          mountPath: /config/a
+        - name: volumeB
+          mountPath: /config/b.yml
+          subPath: b.yml
+        - name: volumeC
+          mountPath: /config/c
+        - name: volumeD
+          mountPath: /secrets/d
+      volumes:
+        - name: volumeA
+          configMap:
+            name: config-a
+        - name: volumeB
+          configMap:
+            name: config-b
+        - name: volumeC
+          configMap:
+            name: config-c
+        - name: volumeD
+          secret:
+            secretName: secret-d`)
+
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+	expected := []string{
+		"configmap/test-namespace/config-a",
+		"secret/test-namespace/secret-d",
+	}
+
+	equals(t, md.HotReloadedConfigs(), expected)
+}
+
+func TestMetaDeploymentHotReloadedConfigsExcludesEnvReferencedAndUnmountedConfigs(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  annotations:
+    com.xing.deployment-restart.hot-reload-volumes: enabled
+spec:
+  template:
+    spec:
+      initContainers:
+      - env:
+        - name: TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: secret-b
+              key: token
+      containers:
+      - env:
+        - name: LEVEL
+          valueFrom:
+            configMapKeyRef:
+              name: config-a
+              key: level
+        volumeMounts:
+        - name: volumeA
+          mountPath: /config/a
+        - name: volumeP
+          mountPath: /projected
+      volumes:
+        - name: volumeA
+          configMap:
+            name: config-a
+        - name: volumeP
+          projected:
+            sources:
+            - configMap:
+                name: config-p
+            - secret:
+                name: secret-b
+        - name: volumeU
+          configMap:
+            name: config-u`)
+
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+	expected := []string{
+		"configmap/test-namespace/config-p",
+	}
+
+	equals(t, md.HotReloadedConfigs(), expected)
+}
+
+func TestMetaDeploymentGracePeriodsAreParsedFromAnnotations(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  annotations:
+    com.xing.deployment-restart.grace-period: "30"
+    com.xing.deployment-restart.max-grace-period: 2m30s
+`)
+
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+
+	gracePeriod, ok := md.GracePeriod()
+	equals(t, gracePeriod, 30*time.Second)
+	equals(t, ok, true)
+	maxGracePeriod, ok := md.MaxGracePeriod()
+	equals(t, maxGracePeriod, 150*time.Second)
+	equals(t, ok, true)
+}
+
+func TestMetaDeploymentGracePeriodsOfZeroAreSet(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  annotations:
+    com.xing.deployment-restart.grace-period: "0"
+`)
+
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+
+	gracePeriod, ok := md.GracePeriod()
+	equals(t, gracePeriod, time.Duration(0))
+	equals(t, ok, true)
+}
+
+func TestMetaDeploymentGracePeriodsAreUnsetWhenAnnotationsAreNotSetOrInvalid(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  annotations:
+    com.xing.deployment-restart.grace-period: soon
+`)
+
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+
+	_, ok := md.GracePeriod()
+	equals(t, ok, false)
+	_, ok = md.MaxGracePeriod()
+	equals(t, ok, false)
+}
+
+func TestMetaDeploymentRestartWaveIsReadFromAnnotationOrLabel(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  labels:
+    com.xing.deployment-restart.wave: last
+`)
+
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).RestartWave(), "last")
+
+	d.Annotations = map[string]string{"com.xing.deployment-restart.wave": "canary"}
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).RestartWave(), "canary")
+
+	d.Labels = nil
+	d.Annotations = nil
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).RestartWave(), "")
+}
+
+func TestMetaDeploymentRestartWindowIsParsedFromAnnotation(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  annotations:
+    com.xing.deployment-restart.restart-window: "* 0-5 * * *"
+`)
+
+	window, err := MetaDeploymentFromDeployment(d, DefaultAnnotations()).RestartWindow()
+	equals(t, window.String(), "* 0-5 * * *")
+	equals(t, err, nil)
+
+	d.Annotations = nil
+	window, err = MetaDeploymentFromDeployment(d, DefaultAnnotations()).RestartWindow()
+	equals(t, window == nil, true)
+	equals(t, err, nil)
+}
+
+func TestMetaDeploymentRestartWindowFailsOnInvalidAnnotation(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  annotations:
+    com.xing.deployment-restart.restart-window: at night
+`)
+
+	window, err := MetaDeploymentFromDeployment(d, DefaultAnnotations()).RestartWindow()
+	equals(t, window == nil, true)
+	equals(t, err != nil, true)
+}
+
+func TestMetaDeploymentTemplateChecksumIgnoresRestartTriggerAnnotation(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+spec:
+  template:
+    metadata:
+      annotations:
+        com.xing.deployment-restart.timestamp: Oct 19 10:00:00
+    spec:
+      containers:
+      - image: app:1
+`)
+	checksum := MetaDeploymentFromDeployment(d, DefaultAnnotations()).TemplateChecksum()
+
+	d.Spec.Template.Annotations["com.xing.deployment-restart.timestamp"] = "Oct 19 11:00:00"
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).TemplateChecksum(), checksum)
+	equals(t, d.Spec.Template.Annotations["com.xing.deployment-restart.timestamp"], "Oct 19 11:00:00")
+
+	d.Spec.Template.Spec.Containers[0].Image = "app:2"
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).TemplateChecksum() != checksum, true)
+}
+
+func TestMetaDeploymentPausedAndScaledToZeroAreReadFromSpec(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+spec:
+  paused: true
+  replicas: 0
+`)
+
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).RolloutPaused(), true)
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).ScaledToZero(), true)
+
+	d.Spec.Paused = false
+	d.Spec.Replicas = nil
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).RolloutPaused(), false)
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).ScaledToZero(), false)
+
+	s := newStatefulSetFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+spec:
+  replicas: 0
+`)
+	equals(t, MetaDeploymentFromStatefulSet(s, DefaultAnnotations()).RolloutPaused(), false)
+	equals(t, MetaDeploymentFromStatefulSet(s, DefaultAnnotations()).ScaledToZero(), true)
+}
+
+func TestMetaDeploymentRolloutStatusOfDeployment(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  generation: 3
+spec:
+  replicas: 2
+status:
+  observedGeneration: 3
+  replicas: 3
+  updatedReplicas: 2
+  availableReplicas: 2
+`)
+
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).RolloutComplete(), false)
+
+	d.Status.Replicas = 2
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).RolloutComplete(), true)
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).RolloutFailed(), false)
+
+	d.Generation = 4
+	equals(t, MetaDeploymentFromDeployment(d, DefaultAnnotations()).RolloutComplete(), false)
+}
+
+func TestMetaDeploymentRolloutStatusOfDeploymentWithExceededProgressDeadline(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  generation: 3
+status:
+  observedGeneration: 3
+  conditions:
+  - type: Progressing
+    status: "False"
+    reason: ProgressDeadlineExceeded
+`)
+
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+
+	equals(t, md.RolloutComplete(), false)
+	equals(t, md.RolloutFailed(), true)
+}
+
+func TestMetaDeploymentRolloutStatusOfStatefulSet(t *testing.T) {
+	s := newStatefulSetFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  generation: 3
+spec:
+  replicas: 2
+status:
+  observedGeneration: 3
+  readyReplicas: 2
+  currentRevision: test-name-1
+  updateRevision: test-name-2
+`)
+
+	equals(t, MetaDeploymentFromStatefulSet(s, DefaultAnnotations()).RolloutComplete(), false)
+
+	s.Status.CurrentRevision = "test-name-2"
+	equals(t, MetaDeploymentFromStatefulSet(s, DefaultAnnotations()).RolloutComplete(), true)
+
+	s.Status.ReadyReplicas = 1
+	equals(t, MetaDeploymentFromStatefulSet(s, DefaultAnnotations()).RolloutComplete(), false)
+}
+
 func TestMetaDeploymentUpdateConfigChecksumsPatchesDeploymentAnnotation(t *testing.T) {
 	c := test.NewDummyK8sClient()
 	d := newDeploymentFromYAML(`
@@ -189,7 +578,7 @@ metadata:
 `)
 	checksums := map[string]string{"config-one": "checksum-one"}
 
-	md := MetaDeploymentFromDeployment(d)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
 	err := md.UpdateConfigChecksums(c, checksums, false)
 
 	expectedPatchData := map[string]interface{}{
@@ -218,7 +607,7 @@ metadata:
 	currentTimestamp := now.Format(time.Stamp)
 	nextSecondTimestamp := now.Add(time.Duration(-1) * time.Second).Format(time.Stamp)
 
-	md := MetaDeploymentFromStatefulSet(d)
+	md := MetaDeploymentFromStatefulSet(d, DefaultAnnotations())
 	checksums := map[string]string{"config-one": "checksum-one"}
 
 	err := md.UpdateConfigChecksums(c, checksums, true)
@@ -278,7 +667,7 @@ metadata:
   name: test-name
   namespace: test-namespace
 `)
-	md := MetaDeploymentFromDeployment(d)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
 	checksums := map[string]string{}
 	c.Error = errors.New("Oh no")
 
@@ -287,6 +676,112 @@ metadata:
 	equals(t, len(c.Patches), 1)
 }
 
+func TestMetaDeploymentUpdateRolloutStatusPatchesAnnotationAndRecordsEvent(t *testing.T) {
+	c := test.NewDummyK8sClient()
+	d := newStatefulSetFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+`)
+
+	md := MetaDeploymentFromStatefulSet(d, DefaultAnnotations())
+	err := md.UpdateRolloutStatus(c, "failed", []string{"configmap/test-namespace/config-one"})
+
+	annotations := c.Patches[0].Data.(map[string]interface{})["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	var status rolloutStatusValue
+	json.Unmarshal([]byte(annotations["com.xing.deployment-restart.rollout-status"].(string)), &status)
+
+	equals(t, err, nil)
+	equals(t, c.Patches[0].Path, "statefulset/test-namespace/test-name")
+	equals(t, status.State, "failed")
+	equals(t, status.Configs, []string{"configmap/test-namespace/config-one"})
+	equals(t, len(c.Events), 1)
+	equals(t, c.Events[0].InvolvedObject.Kind, "StatefulSet")
+	equals(t, c.Events[0].InvolvedObject.Name, "test-name")
+	equals(t, c.Events[0].Namespace, "test-namespace")
+	equals(t, c.Events[0].Type, "Warning")
+	equals(t, c.Events[0].Reason, "ConfigRestartFailed")
+	equals(t, c.Events[0].Message, "Rollout failed after restart due to changes of configmap/test-namespace/config-one")
+}
+
+func TestMetaDeploymentUpdateRolloutStatusDoesNotRecordEventWhenPatchFails(t *testing.T) {
+	c := test.NewDummyK8sClient()
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+`)
+	c.Error = errors.New("Oh no")
+
+	err := MetaDeploymentFromDeployment(d, DefaultAnnotations()).UpdateRolloutStatus(c, "complete", nil)
+	equals(t, err.Error(), "Oh no")
+	equals(t, len(c.Events), 0)
+}
+
+func TestMetaDeploymentApprovalIsReadFromAnnotations(t *testing.T) {
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+  annotations:
+    com.xing.deployment-restart.approval: required
+    com.xing.deployment-restart.approval-timeout: 1h
+    com.xing.deployment-restart.restart-approved: abc
+    com.xing.deployment-restart.restart-pending: '{"id":"abc","configs":["configmap/test-namespace/config-one"],"timestamp":"2020-01-02T03:04:05Z"}'
+`)
+
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+
+	equals(t, md.ApprovalRequired(), true)
+	timeout, ok := md.ApprovalTimeout()
+	equals(t, timeout, time.Hour)
+	equals(t, ok, true)
+	equals(t, md.ApprovedRestart(), "abc")
+	id, since := md.PendingRestart()
+	equals(t, id, "abc")
+	equals(t, since, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+}
+
+func TestMetaDeploymentUpdatePendingRestartPatchesAnnotationAndRecordsEvent(t *testing.T) {
+	c := test.NewDummyK8sClient()
+	d := newDeploymentFromYAML(`
+---
+metadata:
+  name: test-name
+  namespace: test-namespace
+`)
+	md := MetaDeploymentFromDeployment(d, DefaultAnnotations())
+
+	err := md.UpdatePendingRestart(c, "abc", []string{"configmap/test-namespace/config-one"})
+
+	annotations := c.Patches[0].Data.(map[string]interface{})["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	var pending pendingRestartValue
+	json.Unmarshal([]byte(annotations["com.xing.deployment-restart.restart-pending"].(string)), &pending)
+
+	equals(t, err, nil)
+	equals(t, pending.ID, "abc")
+	equals(t, pending.Configs, []string{"configmap/test-namespace/config-one"})
+	equals(t, c.Events[0].Reason, "ConfigRestartPendingApproval")
+
+	err = md.UpdatePendingRestart(c, "", nil)
+
+	expectedPatchData := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				"com.xing.deployment-restart.restart-pending":  nil,
+				"com.xing.deployment-restart.restart-approved": nil,
+			},
+		},
+	}
+
+	equals(t, err, nil)
+	equals(t, c.Patches[1].Data, expectedPatchData)
+	equals(t, len(c.Events), 1)
+}
+
 func newDeploymentFromYAML(manifest string) (response *apps.Deployment) {
 	createFromYAMLManifest(manifest, &response)
 	return
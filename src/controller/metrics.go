@@ -27,17 +27,199 @@ var (
 	}, []string{})
 
 	// DeploymentAnnotationUpdatesTotal exposes the total number of deployment annotation updates
+	// per namespace, workload kind and trigger
 	DeploymentAnnotationUpdatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "deployment_restart_controller",
 		Name:      "deployment_annotation_updates_total",
 		Help:      "The total number of deployment annotation updates.",
-	}, []string{})
+	}, []string{"namespace", "kind", "trigger"})
 
-	// DeploymentRestartsTotal exposes the total number of deployment restarts triggered
+	// DeploymentRestartsTotal exposes the total number of deployment restarts triggered per
+	// namespace, workload kind and trigger
 	DeploymentRestartsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "deployment_restart_controller",
 		Name:      "deployment_restarts_total",
 		Help:      "The total number of deployment restarts triggered.",
+	}, []string{"namespace", "kind", "trigger"})
+
+	// ConfigRestartsTotal exposes the total number of deployment restarts caused by a config.
+	// The workload label is empty unless workload labels are enabled
+	ConfigRestartsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "config_restarts_total",
+		Help:      "The total number of deployment restarts caused by a config.",
+	}, []string{"config", "workload"})
+
+	// ChangeLatencySeconds exposes the time from the first observation of a change to the
+	// patch of a deployment applying it
+	ChangeLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "change_latency_seconds",
+		Help:      "The time from the first observation of a change to the patch of a deployment applying it.",
+		Buckets:   []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{})
+
+	// PatchDurationSeconds exposes the duration of deployment patch requests
+	PatchDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "patch_duration_seconds",
+		Help:      "The duration of deployment patch requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{})
+
+	// RolloutDurationSeconds exposes the time from a restart to the completion of the rollout
+	RolloutDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "rollout_duration_seconds",
+		Help:      "The time from a restart to the completion of the rollout.",
+		Buckets:   []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{})
+
+	// OldestChangeAgeSeconds exposes the age of the oldest change waiting in the queue
+	OldestChangeAgeSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "oldest_change_age_seconds",
+		Help:      "The age of the oldest change waiting in the queue, excluding deferred restarts.",
+	}, []string{})
+
+	// RestartsThrottledTotal exposes the total number of restarts held back by rate limits
+	RestartsThrottledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "restarts_throttled_total",
+		Help:      "The total number of restarts held back by rate limits.",
+	}, []string{})
+
+	// RolloutsCompletedTotal exposes the total number of rollouts completed after restarts
+	RolloutsCompletedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "rollouts_completed_total",
+		Help:      "The total number of rollouts completed after restarts.",
+	}, []string{})
+
+	// RolloutsFailedTotal exposes the total number of rollouts failed after restarts
+	RolloutsFailedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "rollouts_failed_total",
+		Help:      "The total number of rollouts failed after restarts.",
+	}, []string{})
+
+	// RolloutsTimedOutTotal exposes the total number of rollouts not completed within the
+	// rollout timeout after restarts
+	RolloutsTimedOutTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "rollouts_timed_out_total",
+		Help:      "The total number of rollouts not completed within the rollout timeout after restarts.",
+	}, []string{})
+
+	// RolloutsProgressingTotal exposes the number of rollouts in progress after restarts
+	RolloutsProgressingTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "rollouts_progressing_total",
+		Help:      "The total number of rollouts in progress after restarts.",
+	}, []string{})
+
+	// CircuitBreakersOpenedTotal exposes the total number of circuit breakers opened by
+	// failed rollouts
+	CircuitBreakersOpenedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "circuit_breakers_opened_total",
+		Help:      "The total number of circuit breakers opened by failed rollouts.",
+	}, []string{})
+
+	// CircuitBreakersOpenTotal exposes the number of open circuit breakers
+	CircuitBreakersOpenTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "circuit_breakers_open_total",
+		Help:      "The total number of open circuit breakers.",
+	}, []string{})
+
+	// RestartsDeferredTotal exposes the number of restarts waiting for a restart window
+	RestartsDeferredTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "restarts_deferred_total",
+		Help:      "The total number of restarts waiting for a restart window.",
+	}, []string{})
+
+	// RestartsPendingApprovalTotal exposes the number of restarts waiting for approval
+	RestartsPendingApprovalTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "restarts_pending_approval_total",
+		Help:      "The total number of restarts waiting for approval.",
+	}, []string{})
+
+	// RestartsAutoApprovedTotal exposes the total number of restarts approved by timeout
+	RestartsAutoApprovedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "restarts_auto_approved_total",
+		Help:      "The total number of restarts approved automatically after the approval timeout.",
+	}, []string{})
+
+	// RestartsWaitingForResumeTotal exposes the number of restarts deferred until paused
+	// rollouts are resumed
+	RestartsWaitingForResumeTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "restarts_waiting_for_resume_total",
+		Help:      "The total number of restarts deferred until paused rollouts are resumed.",
+	}, []string{})
+
+	// RestartsInvalidWindowTotal exposes the number of restarts held back by invalid
+	// restart window annotations
+	RestartsInvalidWindowTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "restarts_invalid_window_total",
+		Help:      "The total number of restarts held back by invalid restart window annotations.",
+	}, []string{})
+
+	// RestartsSkippedTotal exposes the total number of restarts skipped for deployments
+	// scaled to zero
+	RestartsSkippedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "restarts_skipped_total",
+		Help:      "The total number of restarts skipped because deployments were scaled to zero.",
+	}, []string{})
+
+	// Paused exposes whether updates of all deployments are paused
+	Paused = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "paused",
+		Help:      "Whether updates of all deployments are paused.",
+	}, []string{})
+
+	// PausedNamespacesTotal exposes the number of namespaces with paused updates
+	PausedNamespacesTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "paused_namespaces_total",
+		Help:      "The total number of namespaces with paused updates of deployments.",
+	}, []string{})
+
+	// ForcedRestartsTotal exposes the total number of restarts requested by force restart
+	// annotations
+	ForcedRestartsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "forced_restarts_total",
+		Help:      "The total number of restarts requested by force restart annotations.",
+	}, []string{})
+
+	// WavePlansFailedTotal exposes the total number of restart wave plans stopped by a
+	// failed rollout
+	WavePlansFailedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "wave_plans_failed_total",
+		Help:      "The total number of restart wave plans stopped by a failed rollout.",
+	}, []string{})
+
+	// WavePlansTotal exposes the number of restart wave plans in progress
+	WavePlansTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "wave_plans_total",
+		Help:      "The total number of restart wave plans in progress.",
+	}, []string{})
+
+	// RestartsQueuedTotal exposes the number of restarts waiting for rate limits
+	RestartsQueuedTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "restarts_queued_total",
+		Help:      "The total number of restarts waiting for rate limits.",
 	}, []string{})
 
 	// ChangesProcessedTotal exposes the total number of resource changes processed
@@ -47,26 +229,68 @@ var (
 		Help:      "The total number of resource changes processed.",
 	}, []string{})
 
-	// ChangesWaitingTotal exposes the total number of changes waiting to be processed
+	// ChangesWaitingTotal exposes the total number of changes waiting to be processed,
+	// excluding deferred restarts
 	ChangesWaitingTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "deployment_restart_controller",
 		Name:      "changes_waiting_total",
-		Help:      "The total number of changes waiting to be processed.",
+		Help:      "The total number of changes waiting to be processed, excluding deferred restarts.",
+	}, []string{})
+
+	// SettingsReloadsTotal exposes the total number of changes of the settings file applied
+	SettingsReloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "settings_reloads_total",
+		Help:      "The total number of changes of the settings file applied.",
+	}, []string{})
+
+	// SettingsReloadErrorsTotal exposes the total number of invalid settings files rejected
+	SettingsReloadErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "deployment_restart_controller",
+		Name:      "settings_reload_errors_total",
+		Help:      "The total number of invalid settings files rejected.",
 	}, []string{})
 )
 
 func init() {
 	counters := []*prometheus.CounterVec{
 		ResourceVersionsTotal,
+		RestartsThrottledTotal,
+		RolloutsCompletedTotal,
+		RolloutsFailedTotal,
+		RolloutsTimedOutTotal,
+		WavePlansFailedTotal,
+		RestartsAutoApprovedTotal,
+		ForcedRestartsTotal,
+		RestartsSkippedTotal,
+		CircuitBreakersOpenedTotal,
+		ChangesProcessedTotal,
+		SettingsReloadsTotal,
+		SettingsReloadErrorsTotal,
+	}
+
+	// Series of labeled counters show up once the label values are known
+	labeledCounters := []*prometheus.CounterVec{
 		DeploymentAnnotationUpdatesTotal,
 		DeploymentRestartsTotal,
-		ChangesProcessedTotal,
+		ConfigRestartsTotal,
 	}
 
 	gauges := []*prometheus.GaugeVec{
 		ConfigsTotal,
 		DeploymentsTotal,
 		ChangesWaitingTotal,
+		OldestChangeAgeSeconds,
+		RestartsQueuedTotal,
+		RestartsDeferredTotal,
+		RestartsPendingApprovalTotal,
+		RestartsWaitingForResumeTotal,
+		RestartsInvalidWindowTotal,
+		Paused,
+		PausedNamespacesTotal,
+		RolloutsProgressingTotal,
+		WavePlansTotal,
+		CircuitBreakersOpenTotal,
 	}
 
 	// Unincremented counters and unset gauges do not show up in /metrics and produce
@@ -77,6 +301,21 @@ func init() {
 		v.WithLabelValues().Add(0)
 	}
 
+	for _, v := range labeledCounters {
+		prometheus.MustRegister(v)
+	}
+
+	histograms := []*prometheus.HistogramVec{
+		ChangeLatencySeconds,
+		PatchDurationSeconds,
+		RolloutDurationSeconds,
+	}
+
+	for _, v := range histograms {
+		prometheus.MustRegister(v)
+		v.WithLabelValues()
+	}
+
 	for _, v := range gauges {
 		prometheus.MustRegister(v)
 		v.WithLabelValues().Set(0)
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	planActionNone    = "up-to-date"
+	planActionPatch   = "patch"
+	planActionRestart = "restart"
+)
+
+// Plan lists the updates the controller would make to the deployments in the cluster
+type Plan struct {
+	Workloads []WorkloadPlan `json:"workloads"`
+}
+
+// WorkloadPlan describes the update the controller would make to a deployment: none, saving
+// config checksums or restarting it
+type WorkloadPlan struct {
+	Name    string       `json:"name"`
+	Action  string       `json:"action"`
+	Configs []ConfigPlan `json:"configs"`
+}
+
+// ConfigPlan compares the current checksum of a config referenced by a deployment with the
+// checksum applied to the deployment
+type ConfigPlan struct {
+	Name            string `json:"name"`
+	Checksum        string `json:"checksum,omitempty"`
+	AppliedChecksum string `json:"appliedChecksum,omitempty"`
+	Missing         bool   `json:"missing,omitempty"`
+	Restart         bool   `json:"restart,omitempty"`
+}
+
+// LoadPlan lists the configs and deployments of the cluster once and plans the updates of
+// the deployments the same way a freshly started controller would
+func LoadPlan(k8sClient kubernetes.Interface, settings Settings) (Plan, error) {
+	agent, err := loadCatalog(k8sClient, settings)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan := Plan{Workloads: []WorkloadPlan{}}
+	for name, deployment := range agent.deployments {
+		checksums, restartConfigs := agent.plannedUpdate(deployment)
+
+		workload := WorkloadPlan{Name: name, Action: planActionNone, Configs: []ConfigPlan{}}
+		if len(restartConfigs) > 0 || deployment.ForcedRestart {
+			workload.Action = planActionRestart
+		} else if !stringMapsEqual(checksums, deployment.AppliedChecksums) {
+			workload.Action = planActionPatch
+		}
+
+		for configName, config := range deployment.Configs {
+			workload.Configs = append(workload.Configs, ConfigPlan{
+				Name:            configName,
+				Checksum:        config.Checksum(),
+				AppliedChecksum: deployment.AppliedChecksums[configName],
+				Missing:         config.Pending(),
+				Restart:         containsString(restartConfigs, configName),
+			})
+		}
+		sort.Slice(workload.Configs, func(i, j int) bool { return workload.Configs[i].Name < workload.Configs[j].Name })
+
+		plan.Workloads = append(plan.Workloads, workload)
+	}
+	sort.Slice(plan.Workloads, func(i, j int) bool { return plan.Workloads[i].Name < plan.Workloads[j].Name })
+
+	return plan, nil
+}
+
+// Drift returns true if any deployment would be updated or references missing configs
+func (p Plan) Drift() bool {
+	for _, workload := range p.Workloads {
+		if workload.Action != planActionNone {
+			return true
+		}
+		for _, config := range workload.Configs {
+			if config.Missing {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Print writes the plan in a human readable form
+func (p Plan) Print(w io.Writer) {
+	for _, workload := range p.Workloads {
+		fmt.Fprintf(w, "%s: %s\n", workload.Name, workload.Action)
+
+		for _, config := range workload.Configs {
+			switch {
+			case config.Missing:
+				fmt.Fprintf(w, "  %s: missing\n", config.Name)
+			case config.Restart:
+				fmt.Fprintf(w, "  %s: %s, applied %s, restart\n", config.Name, config.Checksum, valueOrNone(config.AppliedChecksum))
+			case config.Checksum != config.AppliedChecksum:
+				fmt.Fprintf(w, "  %s: %s, applied %s\n", config.Name, config.Checksum, valueOrNone(config.AppliedChecksum))
+			default:
+				fmt.Fprintf(w, "  %s: %s\n", config.Name, config.Checksum)
+			}
+		}
+	}
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
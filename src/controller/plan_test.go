@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"bytes"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadPlanReportsRestartsPatchesAndMissingConfigs(t *testing.T) {
+	settings := newConfigMap("test", "settings", "1", map[string]string{"key": "value"}) // checksum e43abcf337524483
+	restarted := planDeployment("restarted", `{"configmap/test/settings":"outdated"}`, "settings")
+	patched := planDeployment("patched", `{}`, "settings")
+	upToDate := planDeployment("up-to-date", `{"configmap/test/settings":"e43abcf337524483"}`, "settings")
+	missing := planDeployment("missing", `{"configmap/test/settings":"e43abcf337524483"}`, "settings", "gone")
+	k8sClient := fake.NewSimpleClientset(settings, restarted, patched, upToDate, missing)
+
+	plan, err := LoadPlan(k8sClient, Settings{Annotations: DefaultAnnotations()})
+
+	equals(t, err, nil)
+	equals(t, len(plan.Workloads), 4)
+	equals(t, plan.Workloads[0].Name, "deployment/test/missing")
+	equals(t, plan.Workloads[0].Action, planActionNone)
+	equals(t, plan.Workloads[0].Configs[0], ConfigPlan{Name: "configmap/test/gone", Missing: true})
+	equals(t, plan.Workloads[1].Name, "deployment/test/patched")
+	equals(t, plan.Workloads[1].Action, planActionPatch)
+	equals(t, plan.Workloads[2].Name, "deployment/test/restarted")
+	equals(t, plan.Workloads[2].Action, planActionRestart)
+	equals(t, plan.Workloads[2].Configs[0], ConfigPlan{
+		Name:            "configmap/test/settings",
+		Checksum:        "e43abcf337524483",
+		AppliedChecksum: "outdated",
+		Restart:         true,
+	})
+	equals(t, plan.Workloads[3].Action, planActionNone)
+	equals(t, plan.Drift(), true)
+
+	var output bytes.Buffer
+	plan.Print(&output)
+	equals(t, output.String(), `deployment/test/missing: up-to-date
+  configmap/test/gone: missing
+  configmap/test/settings: e43abcf337524483
+deployment/test/patched: patch
+  configmap/test/settings: e43abcf337524483, applied none
+deployment/test/restarted: restart
+  configmap/test/settings: e43abcf337524483, applied outdated, restart
+deployment/test/up-to-date: up-to-date
+  configmap/test/settings: e43abcf337524483
+`)
+}
+
+func TestLoadPlanReportsNoDriftWhenDeploymentsAreUpToDate(t *testing.T) {
+	settings := newConfigMap("test", "settings", "1", map[string]string{"key": "value"})
+	upToDate := planDeployment("up-to-date", `{"configmap/test/settings":"e43abcf337524483"}`, "settings")
+
+	plan, err := LoadPlan(fake.NewSimpleClientset(settings, upToDate), Settings{Annotations: DefaultAnnotations()})
+
+	equals(t, err, nil)
+	equals(t, plan.Drift(), false)
+}
+
+func planDeployment(name, appliedChecksums string, configMaps ...string) *apps.Deployment {
+	deployment := newDeploymentFromYAML(`
+---
+metadata:
+  namespace: test
+  annotations:
+    com.xing.deployment-restart: enabled
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+`)
+	deployment.Name = name
+	deployment.Annotations[DefaultAnnotations().configChecksums] = appliedChecksums
+	for _, configMap := range configMaps {
+		deployment.Spec.Template.Spec.Containers[0].EnvFrom = append(deployment.Spec.Template.Spec.Containers[0].EnvFrom, core.EnvFromSource{
+			ConfigMapRef: &core.ConfigMapEnvSource{LocalObjectReference: core.LocalObjectReference{Name: configMap}},
+		})
+	}
+	return deployment
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Annotations of Stakater Reloader understood when compatibility is enabled, see
+// Annotations.WithReloader
+const (
+	reloaderAutoAnnotation       = "reloader.stakater.com/auto"
+	reloaderConfigMapsAnnotation = "configmap.reloader.stakater.com/reload"
+	reloaderSecretsAnnotation    = "secret.reloader.stakater.com/reload"
+)
+
+// reloaderAuto returns true if the deployment asks Reloader to restart it on changes of all
+// configs referenced in its pod spec
+func (a Annotations) reloaderAuto(meta metav1.ObjectMeta) bool {
+	return a.reloader && meta.Annotations[reloaderAutoAnnotation] == "true"
+}
+
+// reloaderConfigNames returns the full names of the configs listed in the Reloader
+// annotations of the deployment. The lists are comma separated names of ConfigMaps or
+// Secrets in the namespace of the deployment
+func (a Annotations) reloaderConfigNames(meta metav1.ObjectMeta) []string {
+	if !a.reloader {
+		return nil
+	}
+
+	var configs []string
+	for annotation, typ := range map[string]string{
+		reloaderConfigMapsAnnotation: configTypeConfigMap,
+		reloaderSecretsAnnotation:    configTypeSecret,
+	} {
+		for _, name := range strings.Split(meta.Annotations[annotation], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				configs = append(configs, FullName(typ, meta.Namespace, name))
+			}
+		}
+	}
+
+	return configs
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"testing"
+)
+
+const reloaderTemplate = `
+spec:
+  template:
+    spec:
+      containers:
+      - envFrom:
+        - configMapRef:
+            name: env
+        - secretRef:
+            name: credentials
+`
+
+func TestMetaDeploymentIgnoresReloaderAnnotationsByDefault(t *testing.T) {
+	md := MetaDeploymentFromDeployment(newDeploymentFromYAML(`
+---
+metadata:
+  annotations:
+    reloader.stakater.com/auto: "true"
+    configmap.reloader.stakater.com/reload: settings
+`), DefaultAnnotations())
+
+	equals(t, md.NeedsRestartOnConfigChange(), false)
+}
+
+func TestMetaDeploymentWithReloaderAutoReferencesConfigsOfThePodSpec(t *testing.T) {
+	md := MetaDeploymentFromDeployment(newDeploymentFromYAML(`
+---
+metadata:
+  namespace: test
+  annotations:
+    reloader.stakater.com/auto: "true"
+`+reloaderTemplate), DefaultAnnotations().WithReloader(true))
+
+	equals(t, md.NeedsRestartOnConfigChange(), true)
+	equals(t, md.ReferencedConfigs(), []string{"configmap/test/env", "secret/test/credentials"})
+}
+
+func TestMetaDeploymentWithReloaderAutoDisabledDoesNotNeedRestarts(t *testing.T) {
+	md := MetaDeploymentFromDeployment(newDeploymentFromYAML(`
+---
+metadata:
+  annotations:
+    reloader.stakater.com/auto: "false"
+`), DefaultAnnotations().WithReloader(true))
+
+	equals(t, md.NeedsRestartOnConfigChange(), false)
+}
+
+func TestMetaDeploymentWithReloaderListsReferencesOnlyTheListedConfigs(t *testing.T) {
+	md := MetaDeploymentFromDeployment(newDeploymentFromYAML(`
+---
+metadata:
+  namespace: test
+  annotations:
+    configmap.reloader.stakater.com/reload: "settings, env"
+    secret.reloader.stakater.com/reload: tls
+`+reloaderTemplate), DefaultAnnotations().WithReloader(true))
+
+	equals(t, md.NeedsRestartOnConfigChange(), true)
+	equals(t, md.ReferencedConfigs(), []string{"configmap/test/env", "configmap/test/settings", "secret/test/tls"})
+}
+
+func TestMetaDeploymentEnabledWithReloaderListsReferencesAllConfigs(t *testing.T) {
+	md := MetaDeploymentFromDeployment(newDeploymentFromYAML(`
+---
+metadata:
+  namespace: test
+  annotations:
+    com.xing.deployment-restart: enabled
+    configmap.reloader.stakater.com/reload: env,settings
+`+reloaderTemplate), DefaultAnnotations().WithReloader(true))
+
+	equals(t, md.ReferencedConfigs(), []string{"configmap/test/env", "configmap/test/settings", "secret/test/credentials"})
+}
+
+func TestMetaDeploymentWithReloaderAutoReferencesConfigsOfAllSourcesOfThePodSpec(t *testing.T) {
+	md := MetaDeploymentFromDeployment(newDeploymentFromYAML(`
+---
+metadata:
+  namespace: test
+  annotations:
+    reloader.stakater.com/auto: "true"
+spec:
+  template:
+    spec:
+      initContainers:
+      - envFrom:
+        - configMapRef:
+            name: migrations
+      containers:
+      - env:
+        - name: LEVEL
+          valueFrom:
+            configMapKeyRef:
+              name: settings
+              key: level
+        - name: TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: token
+              key: token
+      volumes:
+      - name: tls
+        secret:
+          secretName: tls
+      - name: bundle
+        projected:
+          sources:
+          - configMap:
+              name: ca
+          - secret:
+              name: token
+`), DefaultAnnotations().WithReloader(true))
+
+	equals(t, md.ReferencedConfigs(), []string{
+		"configmap/test/ca",
+		"configmap/test/migrations",
+		"configmap/test/settings",
+		"secret/test/tls",
+		"secret/test/token",
+	})
+}
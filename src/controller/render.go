@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
+	"gopkg.in/yaml.v3"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// renderedDocument is a manifest of a stream being rendered, along with the resource it
+// describes if it is a config or a deployment
+type renderedDocument struct {
+	node       *yaml.Node
+	config     interfaces.MetaConfig
+	deployment interfaces.MetaDeployment
+}
+
+// Render reads streams of Kubernetes manifests and writes them as a single stream, with the
+// checksums of the ConfigMaps and Secrets in the streams applied to the enabled Deployments
+// and StatefulSets referencing them, as if the controller had updated them. The pod template
+// of such a deployment is annotated with a checksum of its restarting configs, so that
+// deploying a changed config rolls it out. Resources without a namespace are considered to
+// be in the given one. The given annotations are read and written. Everything else is
+// written unchanged
+func Render(inputs []io.Reader, w io.Writer, namespace string, annotations Annotations) error {
+	var documents []*renderedDocument
+	for _, input := range inputs {
+		decoder := yaml.NewDecoder(input)
+		for {
+			var node yaml.Node
+			err := decoder.Decode(&node)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			document, err := newRenderedDocument(&node, namespace, annotations)
+			if err != nil {
+				return err
+			}
+			if document != nil {
+				documents = append(documents, document)
+			}
+		}
+	}
+
+	checksums := make(map[string]string)
+	for _, document := range documents {
+		if document.config != nil {
+			checksums[document.config.FullName()] = document.config.Checksum()
+		}
+	}
+
+	for _, document := range documents {
+		if document.deployment != nil && document.deployment.NeedsRestartOnConfigChange() {
+			renderChecksums(document, checksums, annotations)
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		if err := encoder.Encode(document.node); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+// newRenderedDocument converts configs and deployments of a manifest into their meta
+// resources. Empty documents are dropped
+func newRenderedDocument(node *yaml.Node, namespace string, annotations Annotations) (*renderedDocument, error) {
+	if len(node.Content) == 0 || node.Content[0].Tag == "!!null" {
+		return nil, nil
+	}
+	if node.Content[0].Kind != yaml.MappingNode {
+		return &renderedDocument{node: node}, nil
+	}
+
+	var body interface{}
+	if err := node.Decode(&body); err != nil {
+		return nil, err
+	}
+	manifest, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(manifest, &typeMeta); err != nil {
+		return nil, err
+	}
+
+	document := &renderedDocument{node: node}
+	switch typeMeta.GroupVersionKind() {
+	case v1.SchemeGroupVersion.WithKind("ConfigMap"):
+		var configMap v1.ConfigMap
+		err = json.Unmarshal(manifest, &configMap)
+		defaultNamespace(&configMap.ObjectMeta, namespace)
+		document.config = MetaConfigFromConfigMap(&configMap, annotations)
+	case v1.SchemeGroupVersion.WithKind("Secret"):
+		var secret v1.Secret
+		err = json.Unmarshal(manifest, &secret)
+		defaultNamespace(&secret.ObjectMeta, namespace)
+		// The API server merges stringData into data when the secret is written
+		for key, value := range secret.StringData {
+			if secret.Data == nil {
+				secret.Data = make(map[string][]byte)
+			}
+			secret.Data[key] = []byte(value)
+		}
+		document.config = MetaConfigFromSecret(&secret, annotations)
+	case appsv1.SchemeGroupVersion.WithKind("Deployment"):
+		var deployment appsv1.Deployment
+		err = json.Unmarshal(manifest, &deployment)
+		defaultNamespace(&deployment.ObjectMeta, namespace)
+		document.deployment = MetaDeploymentFromDeployment(&deployment, annotations)
+	case appsv1.SchemeGroupVersion.WithKind("StatefulSet"):
+		var statefulSet appsv1.StatefulSet
+		err = json.Unmarshal(manifest, &statefulSet)
+		defaultNamespace(&statefulSet.ObjectMeta, namespace)
+		document.deployment = MetaDeploymentFromStatefulSet(&statefulSet, annotations)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s manifest: %s", typeMeta.Kind, err)
+	}
+
+	return document, nil
+}
+
+func defaultNamespace(meta *metav1.ObjectMeta, namespace string) {
+	if meta.Namespace == "" {
+		meta.Namespace = namespace
+	}
+}
+
+// renderChecksums annotates a deployment with the checksums of the referenced configs found
+// in the stream, and its pod template with a checksum of those not hot reloaded
+func renderChecksums(document *renderedDocument, checksums map[string]string, annotations Annotations) {
+	applied := make(map[string]string)
+	restarting := make(map[string]string)
+	hotReloaded := document.deployment.HotReloadedConfigs()
+
+	for _, name := range document.deployment.ReferencedConfigs() {
+		checksum, ok := checksums[name]
+		if !ok {
+			continue
+		}
+		applied[name] = checksum
+		if !containsString(hotReloaded, name) {
+			restarting[name] = checksum
+		}
+	}
+
+	if len(applied) == 0 {
+		return
+	}
+
+	encodedChecksums, _ := json.Marshal(applied) // applied is always a map[string]string
+	root := document.node.Content[0]
+	setMappingValue(mappingNode(root, "metadata", "annotations"), annotations.configChecksums, string(encodedChecksums))
+	setMappingValue(mappingNode(root, "spec", "template", "metadata", "annotations"), annotations.renderedChecksum, getSha(restarting))
+}
+
+// mappingNode returns the mapping node at the path of keys below a mapping node, creating
+// missing or null nodes along the way
+func mappingNode(node *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		child := mappingValue(node, key)
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+		} else if child.Kind != yaml.MappingNode {
+			*child = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		node = child
+	}
+	return node
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets a string value of a mapping node, appending the key if it is missing
+func setMappingValue(node *yaml.Node, key, value string) {
+	if existing := mappingValue(node, key); existing != nil {
+		*existing = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+		return
+	}
+
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	)
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRenderStampsChecksumsOfConfigsInTheStream(t *testing.T) {
+	configs := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  key: value
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+  namespace: other
+stringData:
+  password: secret
+`
+	workloads := `---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: app
+  namespace: other
+  annotations:
+    com.xing.deployment-restart: enabled
+    com.xing.deployment-restart.applied-config-checksums: outdated
+spec:
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+        - name: app
+          envFrom:
+            - secretRef:
+                name: credentials
+            - configMapRef:
+                name: external
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          envFrom:
+            - configMapRef:
+                name: settings
+`
+	var output bytes.Buffer
+
+	err := Render([]io.Reader{strings.NewReader(configs), strings.NewReader(workloads)}, &output, "default", DefaultAnnotations())
+
+	equals(t, err, nil)
+	equals(t, output.String(), configs+`---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: app
+  namespace: other
+  annotations:
+    com.xing.deployment-restart: enabled
+    com.xing.deployment-restart.applied-config-checksums: '{"secret/other/credentials":"3168c327c44422aa"}'
+spec:
+  template:
+    metadata:
+      labels:
+        app: app
+      annotations:
+        com.xing.deployment-restart.rendered-checksum: 10a1b8452d70b2a3
+    spec:
+      containers:
+        - name: app
+          envFrom:
+            - secretRef:
+                name: credentials
+            - configMapRef:
+                name: external
+`+workloads[strings.LastIndex(workloads, "---"):])
+}
+
+func TestRenderExcludesHotReloadedConfigsFromTheTemplateChecksum(t *testing.T) {
+	manifests := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  key: value
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    com.xing.deployment-restart: enabled
+    com.xing.deployment-restart.hot-reload-volumes: enabled
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          volumeMounts:
+            - name: settings
+              mountPath: /settings
+      volumes:
+        - name: settings
+          configMap:
+            name: settings
+`
+	var output bytes.Buffer
+
+	err := Render([]io.Reader{strings.NewReader(manifests)}, &output, "default", DefaultAnnotations())
+
+	equals(t, err, nil)
+	equals(t, strings.Contains(output.String(), `applied-config-checksums: '{"configmap/default/settings":"e43abcf337524483"}'`), true)
+	equals(t, strings.Contains(output.String(), "rendered-checksum: "+getSha(map[string]string{})), true)
+}
+
+func TestRenderFailsOnInvalidManifests(t *testing.T) {
+	var output bytes.Buffer
+
+	err := Render([]io.Reader{strings.NewReader("kind: Deployment\napiVersion: apps/v1\nspec: [\n")}, &output, "default", DefaultAnnotations())
+
+	equals(t, err != nil, true)
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+)
+
+type restartRecord struct {
+	namespace string
+	at        time.Time
+}
+
+// RestartLimiter limits the number of restarts in progress and restarts per minute, both
+// cluster-wide and per namespace
+type RestartLimiter struct {
+	history    []restartRecord
+	inProgress map[string]*Deployment
+}
+
+// NewRestartLimiter returns a restart limiter without recorded restarts
+func NewRestartLimiter() *RestartLimiter {
+	return &RestartLimiter{
+		inProgress: make(map[string]*Deployment),
+	}
+}
+
+// Allow checks if restarting the deployment stays within the limits. Returns the name of
+// the exceeded limit otherwise
+func (l *RestartLimiter) Allow(deployment *Deployment, settings Settings) (bool, string) {
+	l.prune(settings.RolloutTimeout)
+
+	namespace := deployment.meta.Namespace()
+
+	inProgress, inProgressInNamespace := 0, 0
+	for _, d := range l.inProgress {
+		inProgress++
+		if d.meta.Namespace() == namespace {
+			inProgressInNamespace++
+		}
+	}
+
+	lastMinute, lastMinuteInNamespace := 0, 0
+	for _, record := range l.history {
+		lastMinute++
+		if record.namespace == namespace {
+			lastMinuteInNamespace++
+		}
+	}
+
+	switch {
+	case exceeds(inProgress, settings.MaxConcurrentRestarts):
+		return false, fmt.Sprintf("%d concurrent restarts", settings.MaxConcurrentRestarts)
+	case exceeds(inProgressInNamespace, settings.MaxConcurrentRestartsPerNamespace):
+		return false, fmt.Sprintf("%d concurrent restarts in namespace %s", settings.MaxConcurrentRestartsPerNamespace, namespace)
+	case exceeds(lastMinute, settings.MaxRestartsPerMinute):
+		return false, fmt.Sprintf("%d restarts per minute", settings.MaxRestartsPerMinute)
+	case exceeds(lastMinuteInNamespace, settings.MaxRestartsPerMinutePerNamespace):
+		return false, fmt.Sprintf("%d restarts per minute in namespace %s", settings.MaxRestartsPerMinutePerNamespace, namespace)
+	}
+
+	return true, ""
+}
+
+// Record registers a restart of the deployment
+func (l *RestartLimiter) Record(deployment *Deployment) {
+	l.history = append(l.history, restartRecord{namespace: deployment.meta.Namespace(), at: time.Now()})
+	l.inProgress[deployment.meta.FullName()] = deployment
+}
+
+// Forget removes a deleted deployment from the restarts in progress
+func (l *RestartLimiter) Forget(deploymentName string) {
+	delete(l.inProgress, deploymentName)
+}
+
+func (l *RestartLimiter) prune(rolloutTimeout time.Duration) {
+	for name, deployment := range l.inProgress {
+		if !deployment.RestartInProgress(rolloutTimeout) {
+			delete(l.inProgress, name)
+		}
+	}
+
+	i := 0
+	for i < len(l.history) && time.Now().Sub(l.history[i].at) >= time.Minute {
+		i++
+	}
+	l.history = l.history[i:]
+}
+
+func exceeds(value, limit int) bool {
+	return limit > 0 && value >= limit
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/test"
+)
+
+func TestRestartLimiterAllowsRestartsWithoutLimits(t *testing.T) {
+	l := NewRestartLimiter()
+	d := restartedDeployment("one", "test")
+	l.Record(d)
+
+	allowed, _ := l.Allow(restartedDeployment("two", "test"), Settings{RolloutTimeout: time.Minute})
+	equals(t, allowed, true)
+}
+
+func TestRestartLimiterLimitsConcurrentRestarts(t *testing.T) {
+	l := NewRestartLimiter()
+	settings := Settings{MaxConcurrentRestarts: 1, RolloutTimeout: time.Minute}
+	l.Record(restartedDeployment("one", "test"))
+
+	allowed, limit := l.Allow(restartedDeployment("two", "other"), settings)
+	equals(t, allowed, false)
+	equals(t, limit, "1 concurrent restarts")
+}
+
+func TestRestartLimiterLimitsConcurrentRestartsPerNamespace(t *testing.T) {
+	l := NewRestartLimiter()
+	settings := Settings{MaxConcurrentRestartsPerNamespace: 1, RolloutTimeout: time.Minute}
+	l.Record(restartedDeployment("one", "test"))
+
+	allowed, limit := l.Allow(restartedDeployment("two", "test"), settings)
+	equals(t, allowed, false)
+	equals(t, limit, "1 concurrent restarts in namespace test")
+
+	allowed, _ = l.Allow(restartedDeployment("three", "other"), settings)
+	equals(t, allowed, true)
+}
+
+func TestRestartLimiterAllowsRestartsWhenRestartsInProgressComplete(t *testing.T) {
+	l := NewRestartLimiter()
+	settings := Settings{MaxConcurrentRestarts: 1, RolloutTimeout: time.Minute}
+	d := restartedDeployment("one", "test")
+	l.Record(d)
+
+	meta := d.meta.(*test.DummyMetaDeployment)
+	meta.GenerationValue++
+	meta.RolloutCompleteValue = true
+
+	allowed, _ := l.Allow(restartedDeployment("two", "test"), settings)
+	equals(t, allowed, true)
+}
+
+func TestRestartLimiterLimitsRestartsPerMinute(t *testing.T) {
+	l := NewRestartLimiter()
+	settings := Settings{MaxRestartsPerMinute: 1}
+	l.Record(restartedDeployment("one", "test"))
+
+	allowed, limit := l.Allow(restartedDeployment("two", "other"), settings)
+	equals(t, allowed, false)
+	equals(t, limit, "1 restarts per minute")
+}
+
+func TestRestartLimiterLimitsRestartsPerMinutePerNamespace(t *testing.T) {
+	l := NewRestartLimiter()
+	settings := Settings{MaxRestartsPerMinutePerNamespace: 1}
+	l.Record(restartedDeployment("one", "test"))
+
+	allowed, limit := l.Allow(restartedDeployment("two", "test"), settings)
+	equals(t, allowed, false)
+	equals(t, limit, "1 restarts per minute in namespace test")
+
+	allowed, _ = l.Allow(restartedDeployment("three", "other"), settings)
+	equals(t, allowed, true)
+}
+
+func TestRestartLimiterForgetsDeletedDeployments(t *testing.T) {
+	l := NewRestartLimiter()
+	settings := Settings{MaxConcurrentRestarts: 1, RolloutTimeout: time.Minute}
+	d := restartedDeployment("one", "test")
+	l.Record(d)
+	l.Forget(d.meta.FullName())
+
+	allowed, _ := l.Allow(restartedDeployment("two", "test"), settings)
+	equals(t, allowed, true)
+}
+
+func restartedDeployment(name, namespace string) *Deployment {
+	meta := test.NewDummyMetaDeployment()
+	meta.FullNameValue = FullName(deploymentTypeDeployment, namespace, name)
+	meta.NamespaceValue = namespace
+
+	d := NewDeployment(meta)
+	d.SaveChecksums(nil, true)
+	return d
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+type rolloutStatus struct {
+	complete bool
+	failed   bool
+}
+
+// deploymentRolloutStatus follows the logic of kubectl rollout status for Deployments
+func deploymentRolloutStatus(deployment *appsv1.Deployment) rolloutStatus {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return rolloutStatus{}
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == v1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+			return rolloutStatus{failed: true}
+		}
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	status := deployment.Status
+	return rolloutStatus{
+		complete: status.UpdatedReplicas >= replicas && status.Replicas <= status.UpdatedReplicas && status.AvailableReplicas >= status.UpdatedReplicas,
+	}
+}
+
+// statefulSetRolloutStatus follows the logic of kubectl rollout status for StatefulSets.
+// Rollouts of StatefulSets with OnDelete update strategy are always considered complete
+func statefulSetRolloutStatus(statefulSet *appsv1.StatefulSet) rolloutStatus {
+	if statefulSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return rolloutStatus{complete: true}
+	}
+
+	if statefulSet.Status.ObservedGeneration == 0 || statefulSet.Generation > statefulSet.Status.ObservedGeneration {
+		return rolloutStatus{}
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+
+	status := statefulSet.Status
+	return rolloutStatus{
+		complete: status.ReadyReplicas >= replicas && status.UpdateRevision == status.CurrentRevision,
+	}
+}
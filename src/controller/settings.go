@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
+	"github.com/xing/kubernetes-deployment-restart-controller/src/util"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Settings holds the configuration of the controller and its config agent
+type Settings struct {
+	// RestartCheckPeriod is the interval to check for changes ready to be processed
+	RestartCheckPeriod time.Duration
+	// RestartGracePeriod is the time a change waits in the queue before it gets processed
+	RestartGracePeriod time.Duration
+	// RestartMaxGracePeriod enables debouncing when set: every new observation of a
+	// change restarts its grace period, but the change never waits longer than this
+	RestartMaxGracePeriod time.Duration
+	// ConfigTombstonePeriod is the time the checksum of a deleted config is remembered, so
+	// that recreating the config with different data restarts its deployments
+	ConfigTombstonePeriod time.Duration
+	// MaxConcurrentRestarts limits the number of restarts in progress, 0 means no limit
+	MaxConcurrentRestarts int
+	// MaxConcurrentRestartsPerNamespace limits the number of restarts in progress in a
+	// namespace, 0 means no limit
+	MaxConcurrentRestartsPerNamespace int
+	// MaxRestartsPerMinute limits the number of restarts triggered within a minute, 0 means
+	// no limit
+	MaxRestartsPerMinute int
+	// MaxRestartsPerMinutePerNamespace limits the number of restarts triggered within a
+	// minute in a namespace, 0 means no limit
+	MaxRestartsPerMinutePerNamespace int
+	// RestartWaves enables restarting the deployments affected by a config change in waves.
+	// Every value is the cumulative percentage of deployments restarted up to that wave,
+	// following the canary wave
+	RestartWaves []int
+	// RestartWavesMinDeployments is the minimum number of deployments to be restarted by a
+	// config change for the restarts to happen in waves
+	RestartWavesMinDeployments int
+	// CircuitBreakerThreshold is the number of failed rollouts after restarts due to a config
+	// checksum that stops further restarts due to the checksum, 0 disables the breaker
+	CircuitBreakerThreshold int
+	// NamespaceRestartWindows restricts restarts of deployments in a namespace to the times
+	// matching the schedule of the namespace
+	NamespaceRestartWindows map[string]*util.Schedule
+	// RestartFreeze prevents restarts at times matching the schedule, nil means no freeze
+	RestartFreeze *util.Schedule
+	// ApprovalTimeout is the time after which restarts waiting for approval are approved
+	// automatically, 0 means never
+	ApprovalTimeout time.Duration
+	// ControlConfigMap is the namespace/name of the ConfigMap holding the control state of
+	// the controller, e.g. pausing all updates, empty means none
+	ControlConfigMap string
+	// MetricsWorkloadLabels adds the name of the restarted deployment to the per config
+	// restart metric, at the cost of one series per config and deployment
+	MetricsWorkloadLabels bool
+	// LivenessTimeout is the longest time the update loop may be inactive before the
+	// controller is reported unhealthy
+	LivenessTimeout time.Duration
+	// RolloutTimeout is the longest time a restart is considered to be in progress
+	RolloutTimeout time.Duration
+	// IgnoredErrors contains patterns of errors that should not stop the controller
+	IgnoredErrors []string
+	// Namespaces restricts the deployments updated to those in the namespaces, empty means
+	// all namespaces
+	Namespaces []string
+	// Selector restricts the deployments updated to those with matching labels, nil means
+	// all deployments
+	Selector labels.Selector
+	// ControllerClass restricts the deployments updated to those annotated with the class,
+	// empty means those not annotated with any class
+	ControllerClass string
+	// Annotations are the keys of the annotations read and written by the controller, and
+	// whether the annotations of Stakater Reloader are understood
+	Annotations Annotations
+}
+
+// Watches returns true if the deployment is of the controller class, in a watched namespace
+// and matches the selector
+func (s Settings) Watches(deployment interfaces.MetaDeployment) bool {
+	if deployment.ControllerClass() != s.ControllerClass {
+		return false
+	}
+	if len(s.Namespaces) > 0 && !containsString(s.Namespaces, deployment.Namespace()) {
+		return false
+	}
+	return s.Selector == nil || s.Selector.Matches(labels.Set(deployment.Labels()))
+}
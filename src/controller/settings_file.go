@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/xing/kubernetes-deployment-restart-controller/src/util"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// fileSettings are the settings given in a settings file. Missing fields keep the value of
+// the command line arguments
+type fileSettings struct {
+	RestartCheckPeriod                *duration         `yaml:"restartCheckPeriod"`
+	RestartGracePeriod                *duration         `yaml:"restartGracePeriod"`
+	RestartMaxGracePeriod             *duration         `yaml:"restartMaxGracePeriod"`
+	ConfigTombstonePeriod             *duration         `yaml:"configTombstonePeriod"`
+	MaxConcurrentRestarts             *int              `yaml:"maxConcurrentRestarts"`
+	MaxConcurrentRestartsPerNamespace *int              `yaml:"maxConcurrentRestartsPerNamespace"`
+	MaxRestartsPerMinute              *int              `yaml:"maxRestartsPerMinute"`
+	MaxRestartsPerMinutePerNamespace  *int              `yaml:"maxRestartsPerMinutePerNamespace"`
+	RestartWaves                      []int             `yaml:"restartWaves"`
+	RestartWavesMinDeployments        *int              `yaml:"restartWavesMinDeployments"`
+	CircuitBreakerThreshold           *int              `yaml:"circuitBreakerThreshold"`
+	NamespaceRestartWindows           map[string]string `yaml:"namespaceRestartWindows"`
+	RestartFreeze                     *string           `yaml:"restartFreeze"`
+	ApprovalTimeout                   *duration         `yaml:"approvalTimeout"`
+	ControlConfigMap                  *string           `yaml:"controlConfigMap"`
+	MetricsWorkloadLabels             *bool             `yaml:"metricsWorkloadLabels"`
+	LivenessTimeout                   *duration         `yaml:"livenessTimeout"`
+	RolloutTimeout                    *duration         `yaml:"rolloutTimeout"`
+	IgnoredErrors                     []string          `yaml:"ignoredErrors"`
+	Namespaces                        []string          `yaml:"namespaces"`
+	Selector                          *string           `yaml:"selector"`
+	ControllerClass                   *string           `yaml:"controllerClass"`
+	AnnotationPrefix                  *string           `yaml:"annotationPrefix"`
+	LegacyAnnotationPrefix            *string           `yaml:"legacyAnnotationPrefix"`
+	ReloaderAnnotations               *bool             `yaml:"reloaderAnnotations"`
+}
+
+// duration is a time.Duration given as a string like 1m30s
+type duration time.Duration
+
+func (d *duration) UnmarshalYAML(node *yaml.Node) error {
+	value, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %s", node.Line, err)
+	}
+	if value < 0 {
+		return fmt.Errorf("line %d: negative duration %s", node.Line, node.Value)
+	}
+	*d = duration(value)
+	return nil
+}
+
+// SettingsFile is a YAML file overriding the settings given as command line arguments
+type SettingsFile struct {
+	path string
+	base Settings
+
+	// checksum is the checksum of the file last loaded successfully, rejected the checksum
+	// of the invalid file last reported
+	checksum string
+	rejected string
+}
+
+// NewSettingsFile creates a settings file overriding the base settings
+func NewSettingsFile(path string, base Settings) *SettingsFile {
+	return &SettingsFile{path: path, base: base}
+}
+
+// Load reads the file and returns the settings, and whether the file changed since it was
+// last loaded successfully. Unknown fields and invalid values are errors
+func (f *SettingsFile) Load() (Settings, bool, error) {
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return Settings{}, false, err
+	}
+
+	checksum := getSha(content)
+	if checksum == f.checksum {
+		return Settings{}, false, nil
+	}
+
+	settings, err := parseSettings(content, f.base)
+	if err != nil {
+		return Settings{}, false, fmt.Errorf("invalid settings file %s: %s", f.path, err)
+	}
+
+	f.checksum = checksum
+	return settings, true, nil
+}
+
+// Watch checks the file for changes every period and passes the settings of a changed file
+// to apply, until stopCh is closed. Invalid files are rejected, the settings last applied
+// remain in effect
+func (f *SettingsFile) Watch(period time.Duration, apply func(Settings), stopCh <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			settings, changed, err := f.Load()
+			if err != nil {
+				f.reject(err)
+				continue
+			}
+			if changed {
+				glog.Infof("Settings file %s changed", f.path)
+				apply(settings)
+				SettingsReloadsTotal.WithLabelValues().Inc()
+			}
+
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// reject reports an error loading the file once per content of the file
+func (f *SettingsFile) reject(err error) {
+	content, _ := os.ReadFile(f.path)
+	if checksum := getSha(content); checksum != f.rejected {
+		f.rejected = checksum
+		glog.Errorf("Keeping the current settings: %s", err)
+		SettingsReloadErrorsTotal.WithLabelValues().Inc()
+	}
+}
+
+// parseSettings overrides the base settings with the fields of the YAML content
+func parseSettings(content []byte, base Settings) (Settings, error) {
+	var file fileSettings
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return Settings{}, err
+	}
+
+	settings := base
+	setDuration(&settings.RestartCheckPeriod, file.RestartCheckPeriod)
+	setDuration(&settings.RestartGracePeriod, file.RestartGracePeriod)
+	setDuration(&settings.RestartMaxGracePeriod, file.RestartMaxGracePeriod)
+	setDuration(&settings.ConfigTombstonePeriod, file.ConfigTombstonePeriod)
+	setDuration(&settings.ApprovalTimeout, file.ApprovalTimeout)
+	setDuration(&settings.LivenessTimeout, file.LivenessTimeout)
+	setDuration(&settings.RolloutTimeout, file.RolloutTimeout)
+
+	for _, limit := range []struct {
+		name  string
+		value *int
+		field *int
+	}{
+		{"maxConcurrentRestarts", file.MaxConcurrentRestarts, &settings.MaxConcurrentRestarts},
+		{"maxConcurrentRestartsPerNamespace", file.MaxConcurrentRestartsPerNamespace, &settings.MaxConcurrentRestartsPerNamespace},
+		{"maxRestartsPerMinute", file.MaxRestartsPerMinute, &settings.MaxRestartsPerMinute},
+		{"maxRestartsPerMinutePerNamespace", file.MaxRestartsPerMinutePerNamespace, &settings.MaxRestartsPerMinutePerNamespace},
+		{"restartWavesMinDeployments", file.RestartWavesMinDeployments, &settings.RestartWavesMinDeployments},
+		{"circuitBreakerThreshold", file.CircuitBreakerThreshold, &settings.CircuitBreakerThreshold},
+	} {
+		if limit.value == nil {
+			continue
+		}
+		if *limit.value < 0 {
+			return Settings{}, fmt.Errorf("%s must not be negative", limit.name)
+		}
+		*limit.field = *limit.value
+	}
+
+	if settings.RestartCheckPeriod <= 0 {
+		return Settings{}, errors.New("restartCheckPeriod must be positive")
+	}
+
+	if file.RestartWaves != nil {
+		settings.RestartWaves = file.RestartWaves
+	}
+	if file.ControlConfigMap != nil {
+		settings.ControlConfigMap = *file.ControlConfigMap
+	}
+	if file.MetricsWorkloadLabels != nil {
+		settings.MetricsWorkloadLabels = *file.MetricsWorkloadLabels
+	}
+	if file.IgnoredErrors != nil {
+		settings.IgnoredErrors = file.IgnoredErrors
+	}
+	if file.Namespaces != nil {
+		settings.Namespaces = file.Namespaces
+	}
+	if file.ControllerClass != nil {
+		settings.ControllerClass = *file.ControllerClass
+	}
+	if file.AnnotationPrefix != nil || file.LegacyAnnotationPrefix != nil {
+		prefix, legacyPrefix := settings.Annotations.Prefix(), settings.Annotations.LegacyPrefix()
+		if file.AnnotationPrefix != nil {
+			prefix = *file.AnnotationPrefix
+		}
+		if file.LegacyAnnotationPrefix != nil {
+			legacyPrefix = *file.LegacyAnnotationPrefix
+		}
+		annotations, err := NewAnnotations(prefix, legacyPrefix)
+		if err != nil {
+			return Settings{}, err
+		}
+		settings.Annotations = annotations.WithReloader(settings.Annotations.Reloader())
+	}
+	if file.ReloaderAnnotations != nil {
+		settings.Annotations = settings.Annotations.WithReloader(*file.ReloaderAnnotations)
+	}
+
+	if file.NamespaceRestartWindows != nil {
+		settings.NamespaceRestartWindows = make(map[string]*util.Schedule)
+		for namespace, spec := range file.NamespaceRestartWindows {
+			schedule, err := util.ParseSchedule(spec)
+			if err != nil {
+				return Settings{}, fmt.Errorf("restart window of namespace %s: %s", namespace, err)
+			}
+			settings.NamespaceRestartWindows[namespace] = schedule
+		}
+	}
+
+	if file.RestartFreeze != nil {
+		settings.RestartFreeze = nil
+		if *file.RestartFreeze != "" {
+			schedule, err := util.ParseSchedule(*file.RestartFreeze)
+			if err != nil {
+				return Settings{}, fmt.Errorf("restart freeze: %s", err)
+			}
+			settings.RestartFreeze = schedule
+		}
+	}
+
+	if file.Selector != nil {
+		selector, err := ParseSelector(*file.Selector)
+		if err != nil {
+			return Settings{}, err
+		}
+		settings.Selector = selector
+	}
+
+	return settings, nil
+}
+
+func setDuration(field *time.Duration, value *duration) {
+	if value != nil {
+		*field = time.Duration(*value)
+	}
+}
+
+// ParseSelector parses a label selector like app=web,tier!=cache. An empty selector
+// selects all deployments and is returned as nil
+func ParseSelector(value string) (labels.Selector, error) {
+	if value == "" {
+		return nil, nil
+	}
+	selector, err := labels.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("selector: %s", err)
+	}
+	return selector, nil
+}
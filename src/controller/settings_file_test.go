@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseSettingsOverridesTheGivenFields(t *testing.T) {
+	base := Settings{
+		RestartCheckPeriod:    500 * time.Millisecond,
+		RestartGracePeriod:    5 * time.Second,
+		MaxConcurrentRestarts: 3,
+		IgnoredErrors:         []string{"ignore-me"},
+	}
+
+	settings, err := parseSettings([]byte(`
+restartGracePeriod: 1m30s
+maxRestartsPerMinutePerNamespace: 2
+restartWaves: [10, 50]
+namespaceRestartWindows:
+  production: "* 8-17 * * 1-5"
+restartFreeze: "* * 24-26 12 *"
+controlConfigMap: kube-system/restart-control
+namespaces: [production, staging]
+selector: team=web,tier!=cache
+annotationPrefix: example.com/restart
+reloaderAnnotations: true
+`), base)
+
+	equals(t, err, nil)
+	equals(t, settings.RestartCheckPeriod, 500*time.Millisecond)
+	equals(t, settings.RestartGracePeriod, 90*time.Second)
+	equals(t, settings.MaxConcurrentRestarts, 3)
+	equals(t, settings.MaxRestartsPerMinutePerNamespace, 2)
+	equals(t, settings.RestartWaves, []int{10, 50})
+	equals(t, settings.NamespaceRestartWindows["production"].String(), "* 8-17 * * 1-5")
+	equals(t, settings.RestartFreeze.String(), "* * 24-26 12 *")
+	equals(t, settings.ControlConfigMap, "kube-system/restart-control")
+	equals(t, settings.IgnoredErrors, []string{"ignore-me"})
+	equals(t, settings.Namespaces, []string{"production", "staging"})
+	equals(t, settings.Selector.String(), "team=web,tier!=cache")
+	equals(t, settings.Annotations.Prefix(), "example.com/restart")
+	equals(t, settings.Annotations.LegacyPrefix(), "")
+	equals(t, settings.Annotations.Reloader(), true)
+}
+
+func TestParseSettingsOfAnEmptyFileReturnsTheBaseSettings(t *testing.T) {
+	base := Settings{RestartCheckPeriod: time.Second}
+
+	settings, err := parseSettings([]byte(""), base)
+
+	equals(t, err, nil)
+	equals(t, settings, base)
+}
+
+func TestParseSettingsRejectsInvalidFiles(t *testing.T) {
+	base := Settings{RestartCheckPeriod: time.Second}
+
+	for _, content := range []string{
+		"restartGracePeriod: 5",
+		"restartGracePeriod: -5s",
+		"restartCheckPeriod: 0s",
+		"maxConcurrentRestarts: -1",
+		"maxConcurrentRestarts: many",
+		"restartFreeze: never",
+		"namespaceRestartWindows: {production: always}",
+		"selector: team in web",
+		"annotationPrefix: in valid",
+		"unknownSetting: true",
+		"- a list",
+	} {
+		_, err := parseSettings([]byte(content), base)
+		equals(t, err != nil, true, content)
+	}
+}
+
+func TestSettingsFileLoadReportsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.yaml")
+	os.WriteFile(path, []byte("restartGracePeriod: 10s"), 0o644)
+	file := NewSettingsFile(path, Settings{RestartCheckPeriod: time.Second})
+
+	settings, changed, err := file.Load()
+	equals(t, err, nil)
+	equals(t, changed, true)
+	equals(t, settings.RestartGracePeriod, 10*time.Second)
+
+	_, changed, err = file.Load()
+	equals(t, err, nil)
+	equals(t, changed, false)
+
+	os.WriteFile(path, []byte("restartGracePeriod: ten seconds"), 0o644)
+	_, changed, err = file.Load()
+	equals(t, err != nil, true)
+	equals(t, changed, false)
+}
+
+func TestSettingsFileLoadAppliesChangesOfTheAnnotationSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.yaml")
+	os.WriteFile(path, []byte("annotationPrefix: example.com/restart"), 0o644)
+	base := Settings{RestartCheckPeriod: time.Second, Annotations: DefaultAnnotations().WithReloader(true)}
+	file := NewSettingsFile(path, base)
+
+	settings, _, err := file.Load()
+	equals(t, err, nil)
+	equals(t, settings.Annotations.Prefix(), "example.com/restart")
+	equals(t, settings.Annotations.Reloader(), true)
+
+	os.WriteFile(path, []byte("annotationPrefix: example.com/other\nlegacyAnnotationPrefix: example.com/restart\nreloaderAnnotations: false"), 0o644)
+	settings, changed, err := file.Load()
+	equals(t, err, nil)
+	equals(t, changed, true)
+	equals(t, settings.Annotations.Prefix(), "example.com/other")
+	equals(t, settings.Annotations.LegacyPrefix(), "example.com/restart")
+	equals(t, settings.Annotations.Reloader(), false)
+}
+
+func TestSettingsFileWatchKeepsTheLastGoodSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.yaml")
+	os.WriteFile(path, []byte("restartGracePeriod: 10s"), 0o644)
+	file := NewSettingsFile(path, Settings{RestartCheckPeriod: time.Second})
+	file.Load()
+
+	applied := make(chan Settings, 10)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	reloads := testutil.ToFloat64(SettingsReloadsTotal)
+	errors := testutil.ToFloat64(SettingsReloadErrorsTotal)
+	go file.Watch(5*time.Millisecond, func(settings Settings) { applied <- settings }, stopCh)
+
+	os.WriteFile(path, []byte("restartGracePeriod: 20s\nunknownSetting: true"), 0o644)
+	time.Sleep(50 * time.Millisecond)
+	equals(t, len(applied), 0)
+	equals(t, testutil.ToFloat64(SettingsReloadErrorsTotal)-errors, 1.0)
+
+	os.WriteFile(path, []byte("restartGracePeriod: 30s"), 0o644)
+	select {
+	case settings := <-applied:
+		equals(t, settings.RestartGracePeriod, 30*time.Second)
+	case <-time.After(time.Second):
+		t.Error("Changed settings were not applied")
+	}
+	equals(t, testutil.ToFloat64(SettingsReloadsTotal)-reloads, 1.0)
+}
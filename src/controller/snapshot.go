@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
+)
+
+// snapshotTimeout is the longest time to wait for the update loop to take a snapshot
+const snapshotTimeout = 5 * time.Second
+
+type snapshotRequest struct {
+	filter  interfaces.SnapshotFilter
+	replyCh chan interfaces.Snapshot
+}
+
+// Snapshot returns a copy of the catalog and the change queue matching the filter. The copy
+// is taken by the update loop, so it is consistent and safe to use from other goroutines
+func (c *RealConfigAgent) Snapshot(filter interfaces.SnapshotFilter) (interfaces.Snapshot, error) {
+	request := snapshotRequest{filter: filter, replyCh: make(chan interfaces.Snapshot, 1)}
+
+	select {
+	case c.snapshotCh <- request:
+		return <-request.replyCh, nil
+	case <-time.After(snapshotTimeout):
+		return interfaces.Snapshot{}, errors.New("update loop did not respond in time")
+	}
+}
+
+// snapshot copies the deployments matching the filter, the configs they reference, and the
+// changes of either. Without a workload filter, configs in the namespace are included as well
+func (c *RealConfigAgent) snapshot(filter interfaces.SnapshotFilter) interfaces.Snapshot {
+	result := interfaces.Snapshot{
+		Configs:     make(map[string]interfaces.ConfigSnapshot),
+		Deployments: make(map[string]interfaces.DeploymentSnapshot),
+		Changes:     []interfaces.ChangeSnapshot{},
+	}
+
+	for name, deployment := range c.deployments {
+		if filter.Workload != "" && name != filter.Workload {
+			continue
+		}
+		if filter.Namespace != "" && deployment.meta.Namespace() != filter.Namespace {
+			continue
+		}
+
+		result.Deployments[name] = snapshotDeployment(deployment)
+		for configName, config := range deployment.Configs {
+			result.Configs[configName] = snapshotConfig(config)
+		}
+	}
+
+	if filter.Workload == "" {
+		for name, config := range c.configs {
+			if filter.Namespace == "" || namespaceOf(name) == filter.Namespace {
+				result.Configs[name] = snapshotConfig(config)
+			}
+		}
+	}
+
+	var changes []*Change
+	for name, change := range c.changes {
+		_, isConfig := result.Configs[name]
+		_, isDeployment := result.Deployments[name]
+		if isConfig || isDeployment {
+			changes = append(changes, change)
+		}
+	}
+
+	sortChanges(changes)
+	for _, change := range changes {
+		result.Changes = append(result.Changes, interfaces.ChangeSnapshot{
+			Resource:     change.Resource,
+			Age:          change.Age().Seconds(),
+			Idle:         change.Idle().Seconds(),
+			Observations: change.Observations,
+			Restart:      change.Restart,
+			HoldReason:   change.HoldReason,
+		})
+	}
+
+	return result
+}
+
+func snapshotConfig(config *Config) interfaces.ConfigSnapshot {
+	deployments := make([]string, 0, len(config.Deployments))
+	for name := range config.Deployments {
+		deployments = append(deployments, name)
+	}
+	sort.Strings(deployments)
+
+	return interfaces.ConfigSnapshot{
+		Checksum:      config.Checksum(),
+		Pending:       config.Pending(),
+		ForcedRestart: config.ForcedRestart(),
+		Deployments:   deployments,
+	}
+}
+
+func snapshotDeployment(deployment *Deployment) interfaces.DeploymentSnapshot {
+	configs := make([]string, 0, len(deployment.Configs))
+	for name := range deployment.Configs {
+		configs = append(configs, name)
+	}
+	sort.Strings(configs)
+
+	applied := make(map[string]string, len(deployment.AppliedChecksums))
+	for name, checksum := range deployment.AppliedChecksums {
+		applied[name] = checksum
+	}
+
+	var tombstones map[string]string
+	for name, tombstone := range deployment.Tombstones {
+		if tombstones == nil {
+			tombstones = make(map[string]string)
+		}
+		tombstones[name] = tombstone.Checksum
+	}
+
+	return interfaces.DeploymentSnapshot{
+		Namespace:        deployment.meta.Namespace(),
+		Configs:          configs,
+		AppliedChecksums: applied,
+		Tombstones:       tombstones,
+		HotReloaded:      deployment.meta.HotReloadedConfigs(),
+		NeedsUpdate:      deployment.NeedsUpdate(),
+		ForcedRestart:    deployment.ForcedRestart,
+		RestartedConfigs: deployment.RestartedConfigs,
+		PendingRestartID: deployment.pendingRestartID,
+	}
+}
+
+// namespaceOf returns the namespace part of the full name of a resource
+func namespaceOf(fullName string) string {
+	parts := strings.SplitN(fullName, "/", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
+)
+
+func TestSnapshotIsTakenByTheUpdateLoop(t *testing.T) {
+	a := agent()
+	d := deploymentA()
+
+	a.Start(nil)
+	a.ResourceUpdated(configA())
+	a.ResourceUpdated(d)
+	snapshot, err := a.Snapshot(interfaces.SnapshotFilter{})
+	a.Stop()
+
+	equals(t, err, nil)
+	equals(t, len(snapshot.Deployments), 1)
+	equals(t, snapshot.Deployments[d.FullName()].Configs, []string{configA().FullName(), configB().FullName()})
+	equals(t, snapshot.Deployments[d.FullName()].AppliedChecksums, d.AppliedChecksums())
+	equals(t, snapshot.Configs[configA().FullName()].Checksum, configA().Checksum())
+	equals(t, snapshot.Configs[configA().FullName()].Deployments, []string{d.FullName()})
+	equals(t, snapshot.Configs[configB().FullName()].Pending, true)
+	equals(t, len(snapshot.Changes), 2)
+	equals(t, snapshot.Changes[0].Resource, configA().FullName())
+	equals(t, snapshot.Changes[0].Observations, 1)
+}
+
+func TestSnapshotIsFilteredByNamespaceAndWorkload(t *testing.T) {
+	a := agent()
+	d1 := deploymentA()
+	d1.NamespaceValue = "test"
+	d2 := deploymentB()
+	d2.FullNameValue = "statefulset/other/test-statefulset"
+	d2.NamespaceValue = "other"
+	d2.ReferencedConfigsValue = []string{configB().FullName()}
+	other := configA()
+	other.FullNameValue = "configmap/other/unused"
+
+	observe(a, configA())
+	observe(a, other)
+	observe(a, d1)
+	observe(a, d2)
+
+	snapshot := a.snapshot(interfaces.SnapshotFilter{Namespace: "other"})
+	equals(t, len(snapshot.Deployments), 1)
+	equals(t, snapshot.Deployments[d2.FullName()].Namespace, "other")
+	equals(t, len(snapshot.Configs), 2) // the referenced config and the config in the namespace
+	equals(t, snapshot.Configs[configB().FullName()].Deployments, []string{d1.FullName(), d2.FullName()})
+
+	snapshot = a.snapshot(interfaces.SnapshotFilter{Workload: d1.FullName()})
+	equals(t, len(snapshot.Deployments), 1)
+	equals(t, len(snapshot.Configs), 2)
+	equals(t, len(snapshot.Changes), 2) // of configA and d1
+}
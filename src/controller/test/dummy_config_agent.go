@@ -1,6 +1,8 @@
 package test
 
 import (
+	"time"
+
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
 )
 
@@ -8,6 +10,11 @@ import (
 type DummyConfigAgent struct {
 	UpdatedResources []interfaces.MetaResource
 	DeletedResources []interfaces.MetaResource
+
+	LastActivityValue time.Time
+	SnapshotValue     interfaces.Snapshot
+	SnapshotError     error
+	SnapshotFilter    interfaces.SnapshotFilter
 }
 
 // NewDummyConfigAgent returns a new DummyConfigAgent instance
@@ -17,6 +24,12 @@ func NewDummyConfigAgent() interfaces.ConfigAgent {
 
 func (d *DummyConfigAgent) Start(controllerStopCh chan struct{}) {}
 func (d *DummyConfigAgent) Stop()                                {}
+func (d *DummyConfigAgent) LastActivity() time.Time              { return d.LastActivityValue }
+
+func (d *DummyConfigAgent) Snapshot(filter interfaces.SnapshotFilter) (interfaces.Snapshot, error) {
+	d.SnapshotFilter = filter
+	return d.SnapshotValue, d.SnapshotError
+}
 
 func (d *DummyConfigAgent) ResourceUpdated(res interfaces.MetaResource) {
 	d.UpdatedResources = append(d.UpdatedResources, res)
@@ -2,6 +2,8 @@ package test
 
 import (
 	"fmt"
+
+	v1 "k8s.io/api/core/v1"
 )
 
 type ResourcePatch struct {
@@ -11,6 +13,7 @@ type ResourcePatch struct {
 
 type DummyK8sClient struct {
 	Patches []*ResourcePatch
+	Events  []*v1.Event
 	Error   error
 }
 
@@ -34,3 +37,24 @@ func (c *DummyK8sClient) PatchStatefulSet(namespace, name string, data interface
 	})
 	return c.Error
 }
+
+func (c *DummyK8sClient) PatchConfigMap(namespace, name string, data interface{}) (err error) {
+	c.Patches = append(c.Patches, &ResourcePatch{
+		Path: fmt.Sprintf("configmap/%s/%s", namespace, name),
+		Data: data,
+	})
+	return c.Error
+}
+
+func (c *DummyK8sClient) PatchSecret(namespace, name string, data interface{}) (err error) {
+	c.Patches = append(c.Patches, &ResourcePatch{
+		Path: fmt.Sprintf("secret/%s/%s", namespace, name),
+		Data: data,
+	})
+	return c.Error
+}
+
+func (c *DummyK8sClient) CreateEvent(event *v1.Event) (err error) {
+	c.Events = append(c.Events, event)
+	return c.Error
+}
@@ -1,9 +1,12 @@
 package test
 
 type DummyMetaConfig struct {
-	FullNameValue string
-	VersionValue  string
-	ChecksumValue string
+	FullNameValue            string
+	VersionValue             string
+	ChecksumValue            string
+	BreakerResetValue        string
+	DataValue                map[string]string
+	ForceRestartTriggerValue string
 }
 
 // NewDummyK8sClient returns a dummy implementation
@@ -22,6 +25,9 @@ func NewMetaConfigWithParams(name, version, checksum string) *DummyMetaConfig {
 	}
 }
 
-func (c *DummyMetaConfig) FullName() string { return c.FullNameValue }
-func (c *DummyMetaConfig) Version() string  { return c.VersionValue }
-func (c *DummyMetaConfig) Checksum() string { return c.ChecksumValue }
+func (c *DummyMetaConfig) FullName() string            { return c.FullNameValue }
+func (c *DummyMetaConfig) Version() string             { return c.VersionValue }
+func (c *DummyMetaConfig) Checksum() string            { return c.ChecksumValue }
+func (c *DummyMetaConfig) BreakerReset() string        { return c.BreakerResetValue }
+func (c *DummyMetaConfig) Data() map[string]string     { return c.DataValue }
+func (c *DummyMetaConfig) ForceRestartTrigger() string { return c.ForceRestartTriggerValue }
@@ -1,19 +1,53 @@
 package test
 
 import (
+	"time"
+
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
+	"github.com/xing/kubernetes-deployment-restart-controller/src/util"
 )
 
 type DummyMetaDeployment struct {
 	FullNameValue                   string
 	VersionValue                    string
+	NamespaceValue                  string
+	LabelsValue                     map[string]string
+	ControllerClassValue            string
+	GenerationValue                 int64
+	TemplateChecksumValue           string
+	RolloutCompleteValue            bool
+	RolloutFailedValue              bool
+	RolloutPausedValue              bool
+	ScaledToZeroValue               bool
 	NeedsRestartOnConfigChangeValue bool
 	ReferencedConfigsValue          []string
+	HotReloadedConfigsValue         []string
 	AppliedChecksumsValue           map[string]string
+	GracePeriodValue                *time.Duration
+	MaxGracePeriodValue             *time.Duration
+	RestartWaveValue                string
+	RestartWindowValue              *util.Schedule
+	RestartWindowError              error
+	ApprovalRequiredValue           bool
+	ApprovalTimeoutValue            *time.Duration
+	ApprovedRestartValue            string
+	PendingRestartIDValue           string
+	PendingRestartSinceValue        time.Time
+	ForceRestartTriggerValue        string
 
 	UpdateError      error
 	UpdatedChecksums map[string]string
 	UpdatedRestart   bool
+
+	UpdatedRolloutState   string
+	UpdatedRolloutConfigs []string
+
+	UpdatedPendingRestartID      string
+	UpdatedPendingRestartConfigs []string
+
+	ClearedForceRestartTrigger bool
+
+	RecordedEvents []string
 }
 
 // NewDummyK8sClient returns a dummy implementation
@@ -21,16 +55,74 @@ func NewDummyMetaDeployment() *DummyMetaDeployment {
 	return &DummyMetaDeployment{}
 }
 
-func (d *DummyMetaDeployment) FullName() string { return d.FullNameValue }
-func (d *DummyMetaDeployment) Version() string  { return d.VersionValue }
+func (d *DummyMetaDeployment) FullName() string          { return d.FullNameValue }
+func (d *DummyMetaDeployment) Version() string           { return d.VersionValue }
+func (d *DummyMetaDeployment) Namespace() string         { return d.NamespaceValue }
+func (d *DummyMetaDeployment) Labels() map[string]string { return d.LabelsValue }
+func (d *DummyMetaDeployment) ControllerClass() string   { return d.ControllerClassValue }
+func (d *DummyMetaDeployment) Generation() int64         { return d.GenerationValue }
+func (d *DummyMetaDeployment) TemplateChecksum() string  { return d.TemplateChecksumValue }
+func (d *DummyMetaDeployment) RolloutComplete() bool     { return d.RolloutCompleteValue }
+func (d *DummyMetaDeployment) RolloutFailed() bool       { return d.RolloutFailedValue }
+func (d *DummyMetaDeployment) RolloutPaused() bool       { return d.RolloutPausedValue }
+func (d *DummyMetaDeployment) ScaledToZero() bool        { return d.ScaledToZeroValue }
 func (d *DummyMetaDeployment) NeedsRestartOnConfigChange() bool {
 	return d.NeedsRestartOnConfigChangeValue
 }
 func (d *DummyMetaDeployment) ReferencedConfigs() []string         { return d.ReferencedConfigsValue }
+func (d *DummyMetaDeployment) HotReloadedConfigs() []string        { return d.HotReloadedConfigsValue }
 func (d *DummyMetaDeployment) AppliedChecksums() map[string]string { return d.AppliedChecksumsValue }
+func (d *DummyMetaDeployment) GracePeriod() (time.Duration, bool) {
+	return durationValue(d.GracePeriodValue)
+}
+func (d *DummyMetaDeployment) MaxGracePeriod() (time.Duration, bool) {
+	return durationValue(d.MaxGracePeriodValue)
+}
+func (d *DummyMetaDeployment) RestartWave() string { return d.RestartWaveValue }
+func (d *DummyMetaDeployment) RestartWindow() (*util.Schedule, error) {
+	return d.RestartWindowValue, d.RestartWindowError
+}
+func (d *DummyMetaDeployment) ApprovalRequired() bool { return d.ApprovalRequiredValue }
+func (d *DummyMetaDeployment) ApprovalTimeout() (time.Duration, bool) {
+	return durationValue(d.ApprovalTimeoutValue)
+}
+func (d *DummyMetaDeployment) ApprovedRestart() string     { return d.ApprovedRestartValue }
+func (d *DummyMetaDeployment) ForceRestartTrigger() string { return d.ForceRestartTriggerValue }
+func (d *DummyMetaDeployment) PendingRestart() (string, time.Time) {
+	return d.PendingRestartIDValue, d.PendingRestartSinceValue
+}
 
 func (d *DummyMetaDeployment) UpdateConfigChecksums(k8sClient interfaces.K8sClient, checksums map[string]string, restart bool) error {
 	d.UpdatedChecksums = checksums
 	d.UpdatedRestart = restart
 	return d.UpdateError
 }
+
+func (d *DummyMetaDeployment) UpdateRolloutStatus(k8sClient interfaces.K8sClient, state string, configs []string) error {
+	d.UpdatedRolloutState = state
+	d.UpdatedRolloutConfigs = configs
+	return d.UpdateError
+}
+
+func (d *DummyMetaDeployment) UpdatePendingRestart(k8sClient interfaces.K8sClient, id string, configs []string) error {
+	d.UpdatedPendingRestartID = id
+	d.UpdatedPendingRestartConfigs = configs
+	return d.UpdateError
+}
+
+func (d *DummyMetaDeployment) RecordEvent(k8sClient interfaces.K8sClient, eventType, reason, message string) error {
+	d.RecordedEvents = append(d.RecordedEvents, reason)
+	return nil
+}
+
+func (d *DummyMetaDeployment) ClearForceRestartTrigger(k8sClient interfaces.K8sClient) error {
+	d.ClearedForceRestartTrigger = true
+	return d.UpdateError
+}
+
+func durationValue(value *time.Duration) (time.Duration, bool) {
+	if value == nil {
+		return 0, false
+	}
+	return *value, true
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"time"
+)
+
+// Tombstone stores the checksum of a deleted config that was last applied to a deployment
+type Tombstone struct {
+	Checksum  string
+	deletedAt time.Time
+}
+
+// NewTombstone returns a new tombstone for the given checksum
+func NewTombstone(checksum string) *Tombstone {
+	return &Tombstone{
+		Checksum:  checksum,
+		deletedAt: time.Now(),
+	}
+}
+
+// Age returns the duration since when the config was deleted
+func (t *Tombstone) Age() time.Duration {
+	return time.Now().Sub(t.deletedAt)
+}
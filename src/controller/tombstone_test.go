@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTombstoneReturnsATombstoneWithChecksumAndPositiveAge(t *testing.T) {
+	tombstone := NewTombstone("checksum")
+
+	equals(t, tombstone.Checksum, "checksum")
+	equals(t, tombstone.Age() > time.Duration(0), true)
+}
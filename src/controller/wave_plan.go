@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	restartWaveCanary = "canary"
+	restartWaveLast   = "last"
+)
+
+// WavePlan restarts deployments affected by a config change in waves: canaries first,
+// then growing percentages of the remaining deployments, then the rest. Every wave waits
+// until the rollouts of the previous one complete. A failed rollout stops the plan, and so
+// does a wave that does not complete in time
+type WavePlan struct {
+	Config   string
+	Checksum string
+	waves    [][]string
+	current  int
+	failed   bool
+
+	waveStartedAt time.Time
+}
+
+// NewWavePlan distributes the deployments into waves. Deployments marked as canaries form
+// the first wave, or the first deployment in alphabetical order if there are none.
+// Percentages are cumulative shares of the remaining deployments restarted by the
+// following waves. Deployments marked as last are always restarted by the last wave
+func NewWavePlan(config, checksum string, deployments []*Deployment, percentages []int) *WavePlan {
+	var canaries, regular, last []string
+	for _, deployment := range deployments {
+		switch deployment.meta.RestartWave() {
+		case restartWaveCanary:
+			canaries = append(canaries, deployment.meta.FullName())
+		case restartWaveLast:
+			last = append(last, deployment.meta.FullName())
+		default:
+			regular = append(regular, deployment.meta.FullName())
+		}
+	}
+	sort.Strings(canaries)
+	sort.Strings(regular)
+	sort.Strings(last)
+
+	if len(canaries) == 0 && len(regular) > 0 {
+		canaries, regular = regular[:1], regular[1:]
+	}
+
+	waves := [][]string{canaries}
+	restarted := 0
+	for _, percentage := range percentages {
+		end := len(regular) * percentage / 100
+		if end > len(regular) {
+			end = len(regular)
+		}
+		if end > restarted {
+			waves = append(waves, regular[restarted:end])
+			restarted = end
+		}
+	}
+	if rest := append(regular[restarted:], last...); len(rest) > 0 {
+		waves = append(waves, rest)
+	}
+
+	return &WavePlan{
+		Config:        config,
+		Checksum:      checksum,
+		waves:         waves,
+		waveStartedAt: time.Now(),
+	}
+}
+
+// Holds returns true if the deployment belongs to a wave that has not been started yet, or
+// to any unfinished wave of a failed plan
+func (p *WavePlan) Holds(deploymentName string) bool {
+	first := p.current + 1
+	if p.failed {
+		first = p.current
+	}
+
+	for i := first; i < len(p.waves); i++ {
+		for _, name := range p.waves[i] {
+			if name == deploymentName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Advance starts the next wave once all deployments of the current wave have the config
+// applied and their rollouts completed. Marks the plan as failed if any of the rollouts
+// failed or timed out, or if a deployment of the current wave has not been restarted within
+// the rollout timeout since the wave started, e.g. because its restart is held back
+func (p *WavePlan) Advance(deployments map[string]*Deployment, rolloutTimeout time.Duration) {
+	for !p.failed && !p.Finished() {
+		for _, name := range p.waves[p.current] {
+			deployment, ok := deployments[name]
+			if !ok {
+				continue // deleted deployments do not block the plan
+			}
+
+			if deployment.AppliedChecksums[p.Config] != p.Checksum {
+				p.failed = time.Now().Sub(p.waveStartedAt) >= rolloutTimeout
+				return
+			}
+
+			switch deployment.RolloutState(rolloutTimeout) {
+			case RolloutProgressing:
+				return
+			case RolloutFailed, RolloutTimedOut:
+				p.failed = true
+				return
+			}
+		}
+
+		p.current++
+		p.waveStartedAt = time.Now()
+	}
+}
+
+// Wave returns the number of the current wave, starting with 1
+func (p *WavePlan) Wave() int {
+	return p.current + 1
+}
+
+// Waves returns the total number of waves
+func (p *WavePlan) Waves() int {
+	return len(p.waves)
+}
+
+// Finished returns true when all waves have been completed
+func (p *WavePlan) Finished() bool {
+	return p.current >= len(p.waves)
+}
+
+// Failed returns true when the rollout of a deployment in the current wave failed
+func (p *WavePlan) Failed() bool {
+	return p.failed
+}
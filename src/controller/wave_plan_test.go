@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/test"
+)
+
+func TestNewWavePlanPutsCanariesFirstAndLastDeploymentsLast(t *testing.T) {
+	deployments := []*Deployment{
+		waveDeployment("e", ""),
+		waveDeployment("a", restartWaveLast),
+		waveDeployment("d", ""),
+		waveDeployment("c", restartWaveCanary),
+		waveDeployment("b", ""),
+		waveDeployment("f", ""),
+	}
+
+	plan := NewWavePlan("configmap/test/config", "checksum", deployments, []int{50})
+
+	equals(t, plan.waves, [][]string{
+		{"deployment/test/c"},
+		{"deployment/test/b", "deployment/test/d"},
+		{"deployment/test/e", "deployment/test/f", "deployment/test/a"},
+	})
+}
+
+func TestNewWavePlanPicksCanaryWhenNoneIsDesignated(t *testing.T) {
+	deployments := []*Deployment{
+		waveDeployment("c", ""),
+		waveDeployment("b", ""),
+		waveDeployment("a", ""),
+	}
+
+	plan := NewWavePlan("configmap/test/config", "checksum", deployments, []int{10, 100})
+
+	equals(t, plan.waves, [][]string{
+		{"deployment/test/a"},
+		{"deployment/test/b", "deployment/test/c"},
+	})
+	equals(t, plan.Waves(), 2)
+}
+
+func TestWavePlanHoldsDeploymentsOfLaterWaves(t *testing.T) {
+	canary := waveDeployment("a", "")
+	other := waveDeployment("b", "")
+	plan := NewWavePlan("configmap/test/config", "checksum", []*Deployment{canary, other}, nil)
+
+	equals(t, plan.Holds(canary.meta.FullName()), false)
+	equals(t, plan.Holds(other.meta.FullName()), true)
+}
+
+func TestWavePlanAdvancesWhenRolloutsOfCurrentWaveComplete(t *testing.T) {
+	canary := waveDeployment("a", "")
+	other := waveDeployment("b", "")
+	deployments := map[string]*Deployment{canary.meta.FullName(): canary, other.meta.FullName(): other}
+	plan := NewWavePlan("configmap/test/config", "checksum", []*Deployment{canary, other}, nil)
+
+	plan.Advance(deployments, time.Minute)
+	equals(t, plan.Wave(), 1) // canary has not been restarted yet
+
+	canary.AppliedChecksums["configmap/test/config"] = "checksum"
+	canary.SaveChecksums(nil, true)
+	plan.Advance(deployments, time.Minute)
+	equals(t, plan.Wave(), 1) // canary rollout is in progress
+
+	meta := canary.meta.(*test.DummyMetaDeployment)
+	meta.GenerationValue = 1
+	meta.RolloutCompleteValue = true
+	plan.Advance(deployments, time.Minute)
+
+	equals(t, plan.Wave(), 2)
+	equals(t, plan.Holds(other.meta.FullName()), false)
+	equals(t, plan.Finished(), false)
+
+	delete(deployments, other.meta.FullName())
+	plan.Advance(deployments, time.Minute)
+
+	equals(t, plan.Finished(), true)
+}
+
+func TestWavePlanFailsWhenRolloutOfCurrentWaveFails(t *testing.T) {
+	canary := waveDeployment("a", "")
+	other := waveDeployment("b", "")
+	deployments := map[string]*Deployment{canary.meta.FullName(): canary, other.meta.FullName(): other}
+	plan := NewWavePlan("configmap/test/config", "checksum", []*Deployment{canary, other}, nil)
+
+	canary.AppliedChecksums["configmap/test/config"] = "checksum"
+	canary.SaveChecksums(nil, true)
+	plan.Advance(deployments, 0)
+
+	equals(t, plan.Failed(), true)
+	equals(t, plan.Wave(), 1)
+	equals(t, plan.Holds(canary.meta.FullName()), true)
+	equals(t, plan.Holds(other.meta.FullName()), true)
+}
+
+func TestWavePlanFailsWhenCurrentWaveIsNotRestartedInTime(t *testing.T) {
+	canary := waveDeployment("a", "")
+	other := waveDeployment("b", "")
+	deployments := map[string]*Deployment{canary.meta.FullName(): canary, other.meta.FullName(): other}
+	plan := NewWavePlan("configmap/test/config", "checksum", []*Deployment{canary, other}, nil)
+
+	plan.Advance(deployments, time.Minute)
+	equals(t, plan.Failed(), false)
+
+	plan.Advance(deployments, 0)
+
+	equals(t, plan.Failed(), true)
+	equals(t, plan.Holds(canary.meta.FullName()), true)
+	equals(t, plan.Holds(other.meta.FullName()), true)
+}
+
+func waveDeployment(name, wave string) *Deployment {
+	meta := test.NewDummyMetaDeployment()
+	meta.FullNameValue = FullName(deploymentTypeDeployment, "test", name)
+	meta.NamespaceValue = "test"
+	meta.RestartWaveValue = wave
+	meta.AppliedChecksumsValue = map[string]string{}
+
+	return NewDeployment(meta)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"context"
 
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"github.com/xing/kubernetes-deployment-restart-controller/src/controller/interfaces"
 	"k8s.io/apimachinery/pkg/types"
@@ -36,3 +37,26 @@ func (c *k8sClient) PatchStatefulSet(namespace, name string, patchData interface
 	_, err = c.Interface.AppsV1().StatefulSets(namespace).Patch(context.TODO(), name, types.MergePatchType, encodedData, metav1.PatchOptions{})
 	return
 }
+
+func (c *k8sClient) PatchConfigMap(namespace, name string, patchData interface{}) (err error) {
+	encodedData, err := json.Marshal(patchData)
+	if err != nil {
+		return
+	}
+	_, err = c.Interface.CoreV1().ConfigMaps(namespace).Patch(context.TODO(), name, types.MergePatchType, encodedData, metav1.PatchOptions{})
+	return
+}
+
+func (c *k8sClient) PatchSecret(namespace, name string, patchData interface{}) (err error) {
+	encodedData, err := json.Marshal(patchData)
+	if err != nil {
+		return
+	}
+	_, err = c.Interface.CoreV1().Secrets(namespace).Patch(context.TODO(), name, types.MergePatchType, encodedData, metav1.PatchOptions{})
+	return
+}
+
+func (c *k8sClient) CreateEvent(event *v1.Event) (err error) {
+	_, err = c.Interface.CoreV1().Events(event.Namespace).Create(context.TODO(), event, metav1.CreateOptions{})
+	return
+}
@@ -12,10 +12,32 @@ import (
 	flags "github.com/jessevdk/go-flags"
 )
 
+// Command is an optional subcommand sharing the options of the program
+type Command struct {
+	Name             string
+	ShortDescription string
+	LongDescription  string
+}
+
 // ParseArgs needs a struct compatible to jeddevdk/go-flags and will fill it
 // based on CLI parameters.
 func ParseArgs(options interface{}) {
-	_, err := flags.ParseArgs(options, os.Args)
+	ParseCommandArgs(options)
+}
+
+// ParseCommandArgs works like ParseArgs, but also accepts one of the commands. Options can
+// be given before and after the command. Returns the name of the command given, or an
+// empty string
+func ParseCommandArgs(options interface{}, commands ...Command) string {
+	parser := flags.NewParser(options, flags.Default)
+	parser.SubcommandsOptional = true
+	for _, command := range commands {
+		if _, err := parser.AddCommand(command.Name, command.ShortDescription, command.LongDescription, &struct{}{}); err != nil {
+			panic(err)
+		}
+	}
+
+	_, err := parser.ParseArgs(os.Args[1:])
 	if err != nil {
 		if err.(*flags.Error).Type == flags.ErrHelp {
 			os.Exit(0)
@@ -25,6 +47,11 @@ func ParseArgs(options interface{}) {
 	}
 
 	fixGlog(options)
+
+	if parser.Active == nil {
+		return ""
+	}
+	return parser.Active.Name
 }
 
 // ErrorPrintHelpAndExit prints the message, the help message and exits
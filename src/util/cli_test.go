@@ -50,3 +50,34 @@ func TestParseArgsWithVerboseSet(t *testing.T) {
 		t.Errorf("Verbose was %d", options.Verbose)
 	}
 }
+
+func TestParseCommandArgsAcceptsOptionsAroundTheCommand(t *testing.T) {
+	os.Args = []string{"bin/test", "--host", "kubernetes.io", "plan", "-v", "2"}
+
+	var options struct {
+		Host    string `long:"host"`
+		Verbose int    `short:"v"`
+	}
+
+	command := ParseCommandArgs(&options, Command{Name: "plan"})
+	flag.Set("logtostderr", "false")
+
+	if command != "plan" || options.Host != "kubernetes.io" || options.Verbose != 2 {
+		t.Errorf("Command was %q, host %s, verbose %d", command, options.Host, options.Verbose)
+	}
+}
+
+func TestParseCommandArgsWithoutCommand(t *testing.T) {
+	os.Args = []string{"bin/test", "--host", "kubernetes.io"}
+
+	var options struct {
+		Host string `long:"host"`
+	}
+
+	command := ParseCommandArgs(&options, Command{Name: "plan"})
+	flag.Set("logtostderr", "false")
+
+	if command != "" {
+		t.Errorf("Command was %q", command)
+	}
+}
@@ -0,0 +1,181 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a set of cron expressions matching points in time with minute precision.
+// Expressions have the five standard fields: minute, hour, day of month, month and day of
+// week. They are separated by "|", and a schedule matches a time when any of them does.
+// A leading "CRON_TZ=<location>" sets the time zone of the schedule, which is UTC
+// otherwise
+type Schedule struct {
+	spec        string
+	location    *time.Location
+	expressions []cronExpression
+}
+
+type cronExpression struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	anyDayOfMonth, anyDayOfWeek                bool
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField     = cronField{min: 0, max: 59}
+	hourField       = cronField{min: 0, max: 23}
+	dayOfMonthField = cronField{min: 1, max: 31}
+	monthField      = cronField{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dayOfWeekField = cronField{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// ParseSchedule parses a schedule specification, e.g. "CRON_TZ=Europe/Berlin * 0-6 * * 1-5
+// | * * * * sat,sun"
+func ParseSchedule(spec string) (*Schedule, error) {
+	schedule := &Schedule{spec: spec, location: time.UTC}
+
+	rest := strings.TrimSpace(spec)
+	if strings.HasPrefix(rest, "CRON_TZ=") {
+		fields := strings.SplitN(rest, " ", 2)
+		location, err := time.LoadLocation(strings.TrimPrefix(fields[0], "CRON_TZ="))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule %q: %s", spec, err)
+		}
+		schedule.location = location
+
+		rest = ""
+		if len(fields) == 2 {
+			rest = fields[1]
+		}
+	}
+
+	for _, value := range strings.Split(rest, "|") {
+		expression, err := parseCronExpression(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule %q: %s", spec, err)
+		}
+		schedule.expressions = append(schedule.expressions, expression)
+	}
+
+	return schedule, nil
+}
+
+// Matches returns true if the time matches any of the expressions of the schedule
+func (s *Schedule) Matches(t time.Time) bool {
+	t = t.In(s.location)
+	for _, expression := range s.expressions {
+		if expression.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the schedule specification
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+func parseCronExpression(value string) (cronExpression, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 5 {
+		return cronExpression{}, fmt.Errorf("expected 5 fields in %q", strings.TrimSpace(value))
+	}
+
+	var expression cronExpression
+	var err error
+	targets := []*uint64{&expression.minute, &expression.hour, &expression.dayOfMonth, &expression.month, &expression.dayOfWeek}
+	for i, field := range []cronField{minuteField, hourField, dayOfMonthField, monthField, dayOfWeekField} {
+		if *targets[i], err = field.parse(fields[i]); err != nil {
+			return cronExpression{}, err
+		}
+	}
+
+	// Sunday is both 0 and 7
+	if expression.dayOfWeek&(1<<7) != 0 {
+		expression.dayOfWeek |= 1
+	}
+
+	expression.anyDayOfMonth = fields[2] == "*"
+	expression.anyDayOfWeek = fields[4] == "*"
+
+	return expression, nil
+}
+
+func (f cronField) parse(value string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(value, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", value)
+			}
+			item = item[:i]
+		}
+
+		first, last := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if first, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			last = first
+			if len(bounds) == 2 {
+				if last, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				last = f.max // "5/15" means every 15 starting at 5
+			}
+			if first > last {
+				return 0, fmt.Errorf("invalid range in %q", value)
+			}
+		}
+
+		for i := first; i <= last; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(value string) (int, error) {
+	if number, ok := f.names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < f.min || number > f.max {
+		return 0, fmt.Errorf("invalid value %q, expected %d-%d", value, f.min, f.max)
+	}
+	return number, nil
+}
+
+func (e cronExpression) matches(t time.Time) bool {
+	if e.minute&(1<<uint(t.Minute())) == 0 || e.hour&(1<<uint(t.Hour())) == 0 || e.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dayOfMonth := e.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := e.dayOfWeek&(1<<uint(t.Weekday())) != 0
+
+	// Like cron, restricting both days of month and days of week matches either of them
+	if !e.anyDayOfMonth && !e.anyDayOfWeek {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
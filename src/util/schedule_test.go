@@ -0,0 +1,70 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleMatchesTimesInAnyOfItsExpressions(t *testing.T) {
+	schedule, err := ParseSchedule("* 0-5,22-23 * * mon-fri | * * * * sat,sun")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	cases := map[string]bool{
+		"2023-03-01T05:59:00Z": true,  // Wednesday night
+		"2023-03-01T06:00:00Z": false, // Wednesday morning
+		"2023-03-01T22:30:00Z": true,  // Wednesday evening
+		"2023-03-04T12:00:00Z": true,  // Saturday
+		"2023-03-05T12:00:00Z": true,  // Sunday
+	}
+	for value, expected := range cases {
+		at, _ := time.Parse(time.RFC3339, value)
+		if actual := schedule.Matches(at); actual != expected {
+			t.Errorf("Schedule match of %s: expected %v, got: %v", value, expected, actual)
+		}
+	}
+}
+
+func TestScheduleSupportsStepsAndSundayAsSeven(t *testing.T) {
+	schedule, _ := ParseSchedule("*/15 12 * * 7")
+
+	sunday, _ := time.Parse(time.RFC3339, "2023-03-05T12:30:00Z")
+	if !schedule.Matches(sunday) {
+		t.Errorf("Expected %s to match %s", schedule, sunday)
+	}
+	if schedule.Matches(sunday.Add(time.Minute)) {
+		t.Errorf("Expected %s not to match %s", schedule, sunday.Add(time.Minute))
+	}
+}
+
+func TestScheduleMatchesDayOfMonthOrDayOfWeekWhenBothAreRestricted(t *testing.T) {
+	schedule, _ := ParseSchedule("* * 1 * mon")
+
+	first, _ := time.Parse(time.RFC3339, "2023-03-01T12:00:00Z")  // Wednesday
+	monday, _ := time.Parse(time.RFC3339, "2023-03-06T12:00:00Z") // Monday
+	other, _ := time.Parse(time.RFC3339, "2023-03-07T12:00:00Z")  // Tuesday
+	if !schedule.Matches(first) || !schedule.Matches(monday) || schedule.Matches(other) {
+		t.Errorf("Expected %s to match the first of month and mondays only", schedule)
+	}
+}
+
+func TestScheduleUsesTheGivenTimeZone(t *testing.T) {
+	schedule, err := ParseSchedule("CRON_TZ=Europe/Berlin * 9-17 * * *")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	at, _ := time.Parse(time.RFC3339, "2023-03-01T08:30:00Z") // 09:30 in Berlin
+	if !schedule.Matches(at) {
+		t.Errorf("Expected %s to match %s", schedule, at)
+	}
+}
+
+func TestParseScheduleFailsOnInvalidExpressions(t *testing.T) {
+	for _, spec := range []string{"* * * *", "60 * * * *", "* 5-1 * * *", "* * * * foo", "*/0 * * * *", "CRON_TZ=Nowhere * * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}